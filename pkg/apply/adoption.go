@@ -0,0 +1,133 @@
+package apply
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/obot-platform/nah/pkg/apply/objectset"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type AdoptionMode string
+
+const (
+	// AdoptUnmanaged takes over existing objects that are not managed by apply. This is the default.
+	AdoptUnmanaged AdoptionMode = "Unmanaged"
+	// AdoptNever refuses to take over any existing object that is not already owned by this apply.
+	AdoptNever AdoptionMode = "Never"
+	// AdoptFrom takes over objects that are managed by one of the owners or sub contexts of the policy.
+	// Unmanaged objects are not adopted.
+	AdoptFrom AdoptionMode = "From"
+	// AdoptForce takes over any existing object regardless of its current owner.
+	AdoptForce AdoptionMode = "Force"
+)
+
+// AdoptionPolicy decides if an existing object that was not created by this apply can be taken over.
+// Objects already owned by the same owner, including an owner that is only adding a sub context or a
+// transition registered with AddValidOwnerChange, are always adopted.
+type AdoptionPolicy struct {
+	Mode        AdoptionMode
+	Owners      []Owner
+	SubContexts []string
+}
+
+// Owner identifies the owner of an object as recorded in the owner annotations.
+type Owner struct {
+	GVK        schema.GroupVersionKind
+	Namespace  string
+	Name       string
+	SubContext string
+}
+
+func (o Owner) String() string {
+	return fmt.Sprintf("subcontext [%s] gvk [%s] namespace [%s] name [%s]", o.SubContext, o.GVK, o.Namespace, o.Name)
+}
+
+// OwnerOf returns the owner recorded in the annotations of the object.
+func OwnerOf(obj kclient.Object) Owner {
+	annotations := obj.GetAnnotations()
+	owner := Owner{
+		Namespace:  annotations[LabelNamespace],
+		Name:       annotations[LabelName],
+		SubContext: annotations[LabelSubContext],
+	}
+	if gvk := annotations[LabelGVK]; gvk != "" {
+		_ = getGVK(gvk, &owner.GVK)
+	}
+	return owner
+}
+
+// ErrOwnershipConflict is returned when an object exists and is not allowed to be adopted.
+type ErrOwnershipConflict struct {
+	GVK       schema.GroupVersionKind
+	Key       objectset.ObjectKey
+	DebugID   string
+	Managed   bool
+	Current   Owner
+	Attempted Owner
+	Err       error
+}
+
+func (e *ErrOwnershipConflict) Error() string {
+	if !e.Managed {
+		return fmt.Sprintf("refusing to adopt unmanaged object %s %s for %s: %v", e.Key, e.GVK, e.DebugID, e.Err)
+	}
+	return fmt.Sprintf("failed to update existing owned object %s %s for %s, old subcontext [%s] gvk [%s] namespace [%s] name [%s]: %v",
+		e.Key, e.GVK, e.DebugID, e.Current.SubContext, e.Current.GVK, e.Current.Namespace, e.Current.Name, e.Err)
+}
+
+func (e *ErrOwnershipConflict) Unwrap() error {
+	return e.Err
+}
+
+// WithAdoptionPolicy sets how existing objects that are not owned by this apply are handled.
+func (a apply) WithAdoptionPolicy(policy AdoptionPolicy) Apply {
+	a.adoption = policy
+	return a
+}
+
+func (p AdoptionPolicy) allows(owner Owner) bool {
+	if slices.Contains(p.SubContexts, owner.SubContext) {
+		return true
+	}
+	for _, o := range p.Owners {
+		if o.GVK == owner.GVK && o.Namespace == owner.Namespace && o.Name == owner.Name &&
+			(o.SubContext == "" || o.SubContext == owner.SubContext) {
+			return true
+		}
+	}
+	return false
+}
+
+// adopt checks if the existing object can be taken over by obj. It returns true if the object is managed by a
+// different owner and is transitioning to this owner.
+func (a *apply) adopt(gvk schema.GroupVersionKind, debugID string, k objectset.ObjectKey, existingObj, obj kclient.Object, createErr error) (bool, error) {
+	if annotationsMatch(existingObj, obj) {
+		return false, nil
+	}
+
+	managed := existingObj.GetLabels()[LabelHash] != ""
+	current := OwnerOf(existingObj)
+
+	switch {
+	case managed && (isAssigningSubContext(existingObj, obj) || isAllowOwnerTransition(existingObj, obj)):
+		return true, nil
+	case a.adoption.Mode == AdoptForce:
+		return managed, nil
+	case !managed && (a.adoption.Mode == "" || a.adoption.Mode == AdoptUnmanaged):
+		return false, nil
+	case managed && a.adoption.Mode == AdoptFrom && a.adoption.allows(current):
+		return true, nil
+	}
+
+	return false, &ErrOwnershipConflict{
+		GVK:       gvk,
+		Key:       k,
+		DebugID:   debugID,
+		Managed:   managed,
+		Current:   current,
+		Attempted: OwnerOf(obj),
+		Err:       createErr,
+	}
+}
@@ -0,0 +1,11 @@
+package apply
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// AppliedGVKRecorder is implemented by clients that need to know the GVKs that objects with an owner are applied
+// to with them. New uses it to report every such GVK of the Apply instance to the client.
+type AppliedGVKRecorder interface {
+	RecordAppliedGVK(gvk schema.GroupVersionKind)
+}
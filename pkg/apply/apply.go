@@ -3,9 +3,11 @@ package apply
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/openapi3"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -28,14 +30,24 @@ func AddValidOwnerChange(oldSubcontext, newSubContext string) {
 type Apply interface {
 	Ensure(ctx context.Context, obj ...kclient.Object) error
 	Apply(ctx context.Context, owner kclient.Object, objs ...kclient.Object) error
+	ApplyManifests(ctx context.Context, owner kclient.Object, manifests io.Reader) error
 	WithOwnerSubContext(ownerSubContext string) Apply
 	WithNamespace(ns string) Apply
 	WithPruneGVKs(gvks ...schema.GroupVersionKind) Apply
 	WithPruneTypes(gvks ...kclient.Object) Apply
 	WithNoPrune() Apply
+	WithConcurrency(n int) Apply
+	WithObserver(observer Observer) Apply
+	WithIgnoreFields(gvk schema.GroupVersionKind, paths ...string) Apply
+	WithAdoptionPolicy(policy AdoptionPolicy) Apply
+	WithTransformers(transformers ...Transformer) Apply
+	WithRevisionHistory(history RevisionHistory) Apply
+	WithOpenAPIV3Root(root openapi3.Root) Apply
 
 	FindOwner(ctx context.Context, obj kclient.Object) (kclient.Object, error)
 	PurgeOrphan(ctx context.Context, obj kclient.Object) error
+	ListRevisions(ctx context.Context, owner kclient.Object, history RevisionHistory) ([]RevisionInfo, error)
+	Rollback(ctx context.Context, owner kclient.Object, history RevisionHistory, revision int64) error
 }
 
 func Ensure(ctx context.Context, client kclient.Client, obj ...kclient.Object) error {
@@ -43,9 +55,16 @@ func Ensure(ctx context.Context, client kclient.Client, obj ...kclient.Object) e
 }
 
 func New(c kclient.Client) Apply {
-	return &apply{
+	a := &apply{
 		client:           c,
 		reconcilers:      defaultReconcilers,
 		defaultNamespace: defaultNamespace,
 	}
+	if p, ok := c.(OpenAPIV3RootProvider); ok {
+		a.openAPIV3Root = p.OpenAPIV3Root()
+	}
+	if r, ok := c.(AppliedGVKRecorder); ok {
+		a.appliedRecorder = r
+	}
+	return a
 }
@@ -0,0 +1,45 @@
+package apply
+
+import (
+	"sync"
+)
+
+// semaphore limits the number of objects applied at the same time. A single semaphore is shared by everything
+// one call to Apply does, so the limit holds across the creates, updates, and deletes of all GVKs.
+type semaphore chan struct{}
+
+// newSemaphore returns nil, which runs everything sequentially, if n is less than or equal to one.
+func newSemaphore(n int) semaphore {
+	if n <= 1 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+// forEach calls f for each item, holding a slot of the semaphore for each call. The returned errors are in the
+// same order as items so that the aggregated error is deterministic.
+func forEach[T any](sem semaphore, items []T, f func(T) error) []error {
+	errs := make([]error, len(items))
+	if sem == nil || len(items) <= 1 {
+		for i, item := range items {
+			errs[i] = f(item)
+		}
+		return errs
+	}
+
+	var wg sync.WaitGroup
+	for i, item := range items {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = f(item)
+		}()
+	}
+	wg.Wait()
+
+	return errs
+}
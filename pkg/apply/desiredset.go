@@ -2,9 +2,11 @@ package apply
 
 import (
 	"context"
+	"sync"
 
 	"github.com/obot-platform/nah/pkg/apply/objectset"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/openapi3"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
@@ -25,6 +27,16 @@ type apply struct {
 	ownerGVK         schema.GroupVersionKind
 	ensure           bool
 	noPrune          bool
+	concurrency      int
+	sem              semaphore
+	observers        []Observer
+	observeLock      *sync.Mutex
+	ignoreFields     map[schema.GroupVersionKind][][]string
+	adoption         AdoptionPolicy
+	transformers     []Transformer
+	history          RevisionHistory
+	openAPIV3Root    openapi3.Root
+	appliedRecorder  AppliedGVKRecorder
 }
 
 func (a apply) Ensure(ctx context.Context, objs ...kclient.Object) error {
@@ -66,6 +78,20 @@ func (a apply) WithNoPrune() Apply {
 	return a
 }
 
+// WithConcurrency sets the number of objects that are applied in parallel. GVKs are still applied one after the
+// other in the order they are given. A value less than or equal to one applies everything sequentially.
+func (a apply) WithConcurrency(n int) Apply {
+	a.concurrency = n
+	return a
+}
+
+// WithObserver adds an observer that receives an event for every object created, patched, deleted, or
+// otherwise processed by this apply.
+func (a apply) WithObserver(observer Observer) Apply {
+	a.observers = append(a.observers[:len(a.observers):len(a.observers)], observer)
+	return a
+}
+
 func (a apply) WithPruneTypes(objs ...kclient.Object) Apply {
 	a.pruneObjects = append(a.pruneObjects, objs...)
 	return a
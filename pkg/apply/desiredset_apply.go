@@ -4,6 +4,7 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
+	"sync"
 
 	"github.com/obot-platform/nah/pkg/apply/objectset"
 	"github.com/obot-platform/nah/pkg/merr"
@@ -40,6 +41,8 @@ var (
 )
 
 func (a *apply) apply(objs *objectset.ObjectSet) error {
+	a.observeLock = &sync.Mutex{}
+
 	// retain the original order
 	gvkOrder := objs.GVKOrder(a.knownGVK()...)
 
@@ -54,20 +57,33 @@ func (a *apply) apply(objs *objectset.ObjectSet) error {
 	}
 
 	debugID := a.debugID()
+	objs, err = a.transform(debugID, objs)
+	if err != nil {
+		return err
+	}
+
 	sel, err := GetSelector(labelSet)
 	if err != nil {
 		return err
 	}
 
+	// GVKs are applied one after the other in the original order, because later objects may depend on earlier
+	// ones, and only the objects of a GVK are applied in parallel
+	a.sem = newSemaphore(a.concurrency)
+
 	var errs []error
 	for _, gvk := range gvkOrder {
-		err := a.process(debugID, sel, gvk, objs)
-		if err != nil {
-			errs = append(errs, err)
-		}
+		errs = append(errs, a.process(debugID, sel, gvk, objs))
+	}
+
+	if err := merr.NewErrors(errs...); err != nil {
+		return err
 	}
 
-	return merr.NewErrors(errs...)
+	if a.history.Limit > 0 && !a.ensure {
+		return a.recordRevision(objs)
+	}
+	return nil
 }
 
 func (a *apply) knownGVK() (ret []schema.GroupVersionKind) {
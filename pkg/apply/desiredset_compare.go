@@ -14,6 +14,7 @@ import (
 
 	"github.com/obot-platform/nah/pkg/data"
 	"github.com/obot-platform/nah/pkg/log"
+	"github.com/obot-platform/nah/pkg/untriggered"
 	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -21,11 +22,15 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/openapi3"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
 	LabelApplied = "apply.acorn.io/applied"
+	// AppliedAnnotationStripped is the value of the applied annotation in caches that do not keep the annotation.
+	// Objects with this value are read from the API server before they are compared.
+	AppliedAnnotationStripped = "stripped"
 )
 
 var (
@@ -44,7 +49,7 @@ var (
 )
 
 func prepareObjectForCreate(gvk schema.GroupVersionKind, obj kclient.Object, clone bool) (kclient.Object, error) {
-	serialized, err := serializeApplied(obj)
+	serialized, err := serializeApplied(gvk, obj)
 	if err != nil {
 		return nil, err
 	}
@@ -192,7 +197,15 @@ func (a *apply) applyPatch(gvk schema.GroupVersionKind, debugID string, oldObjec
 		return false, err
 	}
 
-	patchType, patch, err := createPatch(gvk, original, modified, current)
+	if paths := a.ignoredPaths(gvk, newObject); len(paths) > 0 {
+		docs, err := removeFields(paths, original, modified, current)
+		if err != nil {
+			return false, err
+		}
+		original, modified, current = docs[0], docs[1], docs[2]
+	}
+
+	patchType, patch, err := createPatch(a.getOpenAPIV3Root(), gvk, original, modified, current)
 	if err != nil {
 		return false, fmt.Errorf("patch generation: %w", err)
 	}
@@ -210,7 +223,8 @@ func (a *apply) applyPatch(gvk schema.GroupVersionKind, debugID string, oldObjec
 		return false, nil
 	}
 
-	log.Debugf("DesiredSet - Patch %s %s/%s for %s -- [PATCH:%s, ORIGINAL:%s, MODIFIED:%s, CURRENT:%s]", gvk, oldObject.GetNamespace(), oldObject.GetName(), debugID, patch, original, modified, current)
+	log.Debugf("DesiredSet - Patch %s %s/%s for %s -- [PATCH:%s, ORIGINAL:%s, MODIFIED:%s, CURRENT:%s]", gvk, oldObject.GetNamespace(), oldObject.GetName(), debugID,
+		redactJSON(gvk, patch), redactJSON(gvk, original), redactJSON(gvk, modified), redactJSON(gvk, current))
 	reconciler := a.reconcilers[gvk]
 	if reconciler != nil {
 		newObject, err := prepareObjectForCreate(gvk, newObject, true)
@@ -223,12 +237,15 @@ func (a *apply) applyPatch(gvk schema.GroupVersionKind, debugID string, oldObjec
 		}
 		if originalObject == nil {
 			originalObject = oldObject
+		} else if ustr, ok := originalObject.(*unstructured.Unstructured); ok {
+			removeSensitive(gvk, ustr.Object)
 		}
 		handled, err := reconciler(originalObject, newObject)
 		if err != nil {
 			return false, err
 		}
 		if handled {
+			a.observe(objectEvent(EventPatched, gvk, debugID, oldObject))
 			return true, nil
 		}
 	}
@@ -239,16 +256,30 @@ func (a *apply) applyPatch(gvk schema.GroupVersionKind, debugID string, oldObjec
 	ustr.SetNamespace(oldObject.GetNamespace())
 	ustr.SetName(oldObject.GetName())
 
-	log.Debugf("DesiredSet - Updated %s %s/%s for %s -- %s %s", gvk, oldObject.GetNamespace(), oldObject.GetName(), debugID, patchType, patch)
+	log.Debugf("DesiredSet - Updated %s %s/%s for %s -- %s %s", gvk, oldObject.GetNamespace(), oldObject.GetName(), debugID, patchType, redactJSON(gvk, patch))
 	a.log("patching", gvk, oldObject)
+	var patched kclient.Object = ustr
 	if a.ensure {
 		newObject.SetResourceVersion(oldObject.GetResourceVersion())
-		return true, a.client.Patch(a.ctx, newObject, kclient.RawPatch(patchType, patch))
+		patched = newObject
+	}
+	if err := a.client.Patch(a.ctx, patched, kclient.RawPatch(patchType, patch)); err != nil {
+		return true, err
 	}
-	return true, a.client.Patch(a.ctx, ustr, kclient.RawPatch(patchType, patch))
+
+	event := objectEvent(EventPatched, gvk, debugID, patched)
+	event.PatchType = patchType
+	event.Patch = redactJSON(gvk, patch)
+	a.observe(event)
+	return true, nil
 }
 
 func (a *apply) compareObjects(gvk schema.GroupVersionKind, debugID string, oldObject, newObject kclient.Object) error {
+	oldObject, err := a.unstripped(oldObject)
+	if err != nil {
+		return err
+	}
+
 	if ran, err := a.applyPatch(gvk, debugID, oldObject, newObject); err != nil {
 		return err
 	} else if !ran {
@@ -262,11 +293,29 @@ func (a *apply) compareObjects(gvk schema.GroupVersionKind, debugID string, oldO
 			reflect.Indirect(dstVal).Set(reflect.Indirect(srcVal))
 		}
 		log.Debugf("DesiredSet - No change(2) %s %s/%s for %s", gvk, oldObject.GetNamespace(), oldObject.GetName(), debugID)
+		a.observe(objectEvent(EventUnchanged, gvk, debugID, oldObject))
 	}
 
 	return nil
 }
 
+// unstripped reads the object from the API server if the cached object does not have the applied annotation.
+func (a *apply) unstripped(obj kclient.Object) (kclient.Object, error) {
+	if obj.GetAnnotations()[LabelApplied] != AppliedAnnotationStripped {
+		return obj, nil
+	}
+
+	full := obj.DeepCopyObject().(kclient.Object)
+	if err := a.client.Get(a.ctx, kclient.ObjectKeyFromObject(obj), untriggered.UncachedGet(full)); err != nil {
+		return nil, err
+	}
+	if full.GetAnnotations()[LabelApplied] == AppliedAnnotationStripped {
+		// Without the original the removed fields would not be pruned
+		return nil, fmt.Errorf("the %s annotation of %s was overwritten with the placeholder of the cache", LabelApplied, kclient.ObjectKeyFromObject(obj))
+	}
+	return full, nil
+}
+
 func removeMetadataFields(data map[string]any) bool {
 	metadata, ok := data["metadata"]
 	if !ok {
@@ -315,6 +364,9 @@ func getOriginalBytes(gvk schema.GroupVersionKind, obj v1.Object) ([]byte, error
 }
 
 func appliedFromAnnotation(str string) []byte {
+	if str == AppliedAnnotationStripped {
+		return nil
+	}
 	if len(str) == 0 || str[0] == '{' {
 		return []byte(str)
 	}
@@ -383,12 +435,15 @@ func pruneValues(data map[string]any, isList bool) map[string]any {
 	return result
 }
 
-func serializeApplied(obj kclient.Object) ([]byte, error) {
+func serializeApplied(gvk schema.GroupVersionKind, obj kclient.Object) ([]byte, error) {
 	data, err := data.ToMapInterface(obj)
 	if err != nil {
 		return nil, err
 	}
 	data = pruneValues(data, false)
+	// Sensitive values are only needed to detect removed keys in the three-way merge, so a hash of the value
+	// is sufficient and keeps the value out of the annotation.
+	redact(gvk, data)
 	return json.Marshal(data)
 }
 
@@ -405,19 +460,26 @@ func appliedToAnnotation(b []byte) string {
 }
 
 // createPatch is adapted from "kubectl apply"
-func createPatch(gvk schema.GroupVersionKind, original, modified, current []byte) (types.PatchType, []byte, error) {
+func createPatch(root openapi3.Root, gvk schema.GroupVersionKind, original, modified, current []byte) (types.PatchType, []byte, error) {
 	var (
 		patchType types.PatchType
 		patch     []byte
 	)
 
-	patchType, lookupPatchMeta, err := getMergeStyle(gvk)
+	patchType, lookupPatchMeta, err := getMergeStyle(root, gvk)
 	if err != nil {
 		return patchType, nil, err
 	}
 
 	if patchType == types.StrategicMergePatchType {
 		patch, err = strategicpatch.CreateThreeWayMergePatch(original, modified, current, lookupPatchMeta, true)
+	} else if lookupPatchMeta != nil {
+		patch, err = createSchemaMergePatch(original, modified, current, lookupPatchMeta)
+		if err != nil {
+			// Schemas of custom resources are not always complete, such as fields that preserve unknown fields
+			log.Debugf("DesiredSet - Falling back to JSON merge patch for %s: %v", gvk, err)
+			patch, err = jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
+		}
 	} else {
 		patch, err = jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
 	}
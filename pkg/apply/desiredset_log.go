@@ -9,6 +9,9 @@ import (
 )
 
 var (
+	// LogInfo is a global printf style hook for apply operations.
+	//
+	// Deprecated: use Apply.WithObserver to receive structured events.
 	LogInfo func(format string, args ...any)
 )
 
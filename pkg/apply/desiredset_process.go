@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"sync"
 
 	"github.com/obot-platform/nah/pkg/apply/objectset"
 	"github.com/obot-platform/nah/pkg/log"
@@ -185,6 +186,9 @@ func (a *apply) process(debugID string, set labels.Selector, gvk schema.GroupVer
 		if err := a.assignOwnerReference(gvk, objs); err != nil {
 			return err
 		}
+		if len(objs) > 0 && a.appliedRecorder != nil {
+			a.appliedRecorder.RecordAppliedGVK(gvk)
+		}
 	}
 
 	if nsed {
@@ -202,13 +206,19 @@ func (a *apply) process(debugID string, set labels.Selector, gvk schema.GroupVer
 		return fmt.Errorf("failed to list %s for %s: %w", gvk, debugID, err)
 	}
 
-	var toReplace []objectset.ObjectKey
+	var (
+		toReplace []objectset.ObjectKey
+		// lock guards existing, toUpdate, and toReplace which are modified by createF and updateF
+		lock sync.Mutex
+	)
 	toCreate, toDelete, toUpdate := compareSets(existing, objs)
 
 	// check for resources in the objectset but under a different version of the same group/kind
 	toDelete = a.filterCrossVersion(allObjs, gvk, toDelete)
 
-	createF := func(k objectset.ObjectKey) error {
+	// createObject creates the object and emits eventType, which is EventReplaced when a replaced object is
+	// created again
+	createObject := func(k objectset.ObjectKey, eventType EventType) error {
 		obj, err := prepareObjectForCreate(gvk, objs[k], !a.ensure)
 		if err != nil {
 			return fmt.Errorf("failed to prepare create %s %s for %s: %w", k, gvk, debugID, err)
@@ -219,19 +229,25 @@ func (a *apply) process(debugID string, set labels.Selector, gvk schema.GroupVer
 			// Taking over an object that wasn't previously managed by us
 			existingObj, getErr := a.get(gvk, objs[k], k.Namespace, k.Name)
 			if getErr == nil {
-				if !annotationsMatch(existingObj, obj) {
-					if existingObj.GetLabels()[LabelHash] != "" && !isAssigningSubContext(existingObj, obj) && !isAllowOwnerTransition(existingObj, obj) {
-						return fmt.Errorf("failed to update existing owned object %s %s for %s, old subcontext [%s] gvk [%s] namespace [%s] name [%s]: %w", k, gvk, debugID,
-							existingObj.GetAnnotations()[LabelSubContext],
-							existingObj.GetAnnotations()[LabelGVK],
-							existingObj.GetAnnotations()[LabelNamespace],
-							existingObj.GetAnnotations()[LabelName], err)
-					}
+				transition, err := a.adopt(gvk, debugID, k, existingObj, obj, err)
+				if err != nil {
+					event := objectEvent(EventConflict, gvk, debugID, existingObj)
+					event.PreviousSubContext = existingObj.GetAnnotations()[LabelSubContext]
+					event.Err = err
+					a.observe(event)
+					return err
+				}
+				if transition {
+					event := objectEvent(EventOwnerTransition, gvk, debugID, existingObj)
+					event.PreviousSubContext = existingObj.GetAnnotations()[LabelSubContext]
+					a.observe(event)
 				}
+				lock.Lock()
 				if should(obj, AnnotationUpdate) {
 					toUpdate = append(toUpdate, k)
 				}
 				existing[k] = existingObj
+				lock.Unlock()
 				return nil
 			}
 		}
@@ -240,10 +256,15 @@ func (a *apply) process(debugID string, set labels.Selector, gvk schema.GroupVer
 		}
 
 		log.Debugf("DesiredSet - Created %s %s for %s", gvk, k, debugID)
+		a.observe(objectEvent(eventType, gvk, debugID, obj))
 		return nil
 	}
 
-	deleteF := func(k objectset.ObjectKey, force bool) error {
+	createF := func(k objectset.ObjectKey) error {
+		return createObject(k, EventCreated)
+	}
+
+	deleteObject := func(k objectset.ObjectKey) error {
 		if err := a.delete(gvk, k.Namespace, k.Name); err != nil {
 			return fmt.Errorf("failed to delete %s %s for %s: %w", k, gvk, debugID, err)
 		}
@@ -251,11 +272,31 @@ func (a *apply) process(debugID string, set labels.Selector, gvk schema.GroupVer
 		return nil
 	}
 
+	deleteF := func(k objectset.ObjectKey, force bool) error {
+		if err := deleteObject(k); err != nil {
+			return err
+		}
+		a.observe(Event{
+			Type:      EventDeleted,
+			GVK:       gvk,
+			Namespace: k.Namespace,
+			Name:      k.Name,
+			DebugID:   debugID,
+		})
+		return nil
+	}
+
 	updateF := func(k objectset.ObjectKey) error {
-		err := a.compareObjects(gvk, debugID, existing[k], objs[k])
+		lock.Lock()
+		existingObj := existing[k]
+		lock.Unlock()
+
+		err := a.compareObjects(gvk, debugID, existingObj, objs[k])
 		if err == ErrReplace {
-			if objs[k].GetAnnotations()[AnnotationUpdate] == "true" || (should(existing[k], AnnotationPrune) && should(existing[k], AnnotationCreate)) {
+			if objs[k].GetAnnotations()[AnnotationUpdate] == "true" || (should(existingObj, AnnotationPrune) && should(existingObj, AnnotationCreate)) {
+				lock.Lock()
 				toReplace = append(toReplace, k)
+				lock.Unlock()
 			}
 		} else if err != nil {
 			return fmt.Errorf("failed to update %s %s for %s: %w", k, gvk, debugID, err)
@@ -263,28 +304,26 @@ func (a *apply) process(debugID string, set labels.Selector, gvk schema.GroupVer
 		return nil
 	}
 
-	var errs []error
-	for _, k := range toCreate {
-		errs = append(errs, createF(k))
+	deleteNoForceF := func(k objectset.ObjectKey) error {
+		return deleteF(k, false)
 	}
 
-	for _, k := range toUpdate {
-		errs = append(errs, updateF(k))
-	}
+	var errs []error
+	errs = append(errs, forEach(a.sem, toCreate, createF)...)
+	errs = append(errs, forEach(a.sem, toUpdate, updateF)...)
 
 	if !a.noPrune {
-		for _, k := range toDelete {
-			errs = append(errs, deleteF(k, false))
-		}
+		errs = append(errs, forEach(a.sem, toDelete, deleteNoForceF)...)
 	}
 
-	for _, k := range toReplace {
-		errs = append(errs, deleteF(k, false))
-	}
+	// updates run in parallel so sort to keep the replace order stable
+	sortObjectKeys(toReplace)
 
-	for _, k := range toReplace {
-		errs = append(errs, createF(k))
-	}
+	// all deletes must finish before the replacements are created, and only EventReplaced is emitted for them
+	errs = append(errs, forEach(a.sem, toReplace, deleteObject)...)
+	errs = append(errs, forEach(a.sem, toReplace, func(k objectset.ObjectKey) error {
+		return createObject(k, EventReplaced)
+	})...)
 
 	return merr.NewErrors(errs...)
 }
@@ -0,0 +1,145 @@
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AnnotationIgnoreFields is a comma separated list of dot separated field paths, such as "spec.replicas",
+// that are set on create but never updated by apply. See WithIgnoreFields for the syntax of the paths.
+const AnnotationIgnoreFields = LabelPrefix + "ignore-fields"
+
+// WithIgnoreFields sets field paths of the given GVK that are owned by another controller. They are set when
+// the object is created, but apply will never revert changes made to them.
+//
+// A path is a list of fields separated by dots, such as "spec.replicas". A field of the form list[key=value]
+// selects the elements of the list whose key field has the value, such as
+// "spec.template.spec.containers[name=istio-proxy].image", or the whole elements if it is the last field. Lists
+// that are replaced as a whole by patches, such as lists of custom resources without a merge key, are replaced
+// without the ignored fields of their elements when anything else in them changes.
+func (a apply) WithIgnoreFields(gvk schema.GroupVersionKind, paths ...string) Apply {
+	ignoreFields := make(map[schema.GroupVersionKind][][]string, len(a.ignoreFields)+1)
+	for k, v := range a.ignoreFields {
+		ignoreFields[k] = v
+	}
+	for _, path := range paths {
+		ignoreFields[gvk] = append(ignoreFields[gvk][:len(ignoreFields[gvk]):len(ignoreFields[gvk])], splitFieldPath(path))
+	}
+	a.ignoreFields = ignoreFields
+	return a
+}
+
+// splitFieldPath splits the path on the dots that are not in a list element selector.
+func splitFieldPath(path string) []string {
+	var (
+		result []string
+		start  int
+		depth  int
+	)
+	path = strings.TrimPrefix(path, ".")
+	for i, c := range path {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				result = append(result, path[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, path[start:])
+}
+
+// parseListSelector parses a field of the form list[key=value].
+func parseListSelector(field string) (list, key, value string, ok bool) {
+	list, selector, ok := strings.Cut(field, "[")
+	if !ok || !strings.HasSuffix(selector, "]") {
+		return "", "", "", false
+	}
+	key, value, ok = strings.Cut(strings.TrimSuffix(selector, "]"), "=")
+	return list, key, value, ok && list != "" && key != ""
+}
+
+// removeField deletes the field at the path from data, see WithIgnoreFields for the syntax of the path.
+func removeField(data map[string]any, path []string) {
+	if len(path) == 0 {
+		return
+	}
+
+	listField, key, value, ok := parseListSelector(path[0])
+	if !ok {
+		if len(path) == 1 {
+			delete(data, path[0])
+		} else if child, ok := data[path[0]].(map[string]any); ok {
+			removeField(child, path[1:])
+		}
+		return
+	}
+
+	list, ok := data[listField].([]any)
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		kept := make([]any, 0, len(list))
+		for _, item := range list {
+			if !elementSelected(item, key, value) {
+				kept = append(kept, item)
+			}
+		}
+		data[listField] = kept
+		return
+	}
+	for _, item := range list {
+		if elementSelected(item, key, value) {
+			removeField(item.(map[string]any), path[1:])
+		}
+	}
+}
+
+func elementSelected(item any, key, value string) bool {
+	m, ok := item.(map[string]any)
+	if !ok {
+		return false
+	}
+	v, ok := m[key]
+	return ok && fmt.Sprint(v) == value
+}
+
+func (a *apply) ignoredPaths(gvk schema.GroupVersionKind, obj kclient.Object) [][]string {
+	paths := a.ignoreFields[gvk]
+	for _, path := range strings.Split(obj.GetAnnotations()[AnnotationIgnoreFields], ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths[:len(paths):len(paths)], splitFieldPath(path))
+		}
+	}
+	return paths
+}
+
+// removeFields deletes the paths from each of the JSON documents. The documents given to the three-way
+// merge must all be stripped so that a removed field is not interpreted as a deletion.
+func removeFields(paths [][]string, docs ...[]byte) ([][]byte, error) {
+	result := make([][]byte, 0, len(docs))
+	for _, doc := range docs {
+		data := map[string]any{}
+		if err := json.Unmarshal(doc, &data); err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			removeField(data, path)
+		}
+		doc, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, doc)
+	}
+	return result, nil
+}
@@ -0,0 +1,103 @@
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitFieldPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "spec.replicas", want: []string{"spec", "replicas"}},
+		{path: ".spec.replicas", want: []string{"spec", "replicas"}},
+		{
+			path: "spec.template.spec.containers[name=istio-proxy].image",
+			want: []string{"spec", "template", "spec", "containers[name=istio-proxy]", "image"},
+		},
+		{
+			path: "spec.hosts[name=a.example.com].port",
+			want: []string{"spec", "hosts[name=a.example.com]", "port"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitFieldPath(tt.path))
+		})
+	}
+}
+
+func TestRemoveFields(t *testing.T) {
+	const doc = `{
+		"spec": {
+			"replicas": 3,
+			"template": {"spec": {"containers": [
+				{"name": "app", "image": "app:1", "ports": [{"containerPort": 8080, "protocol": "TCP"}]},
+				{"name": "istio-proxy", "image": "proxy:1"}
+			]}}
+		}
+	}`
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{
+			name: "field",
+			path: "spec.replicas",
+			want: `{"spec":{"template":{"spec":{"containers":[` +
+				`{"image":"app:1","name":"app","ports":[{"containerPort":8080,"protocol":"TCP"}]},` +
+				`{"image":"proxy:1","name":"istio-proxy"}]}}}}`,
+		},
+		{
+			name: "field of selected list element",
+			path: "spec.template.spec.containers[name=istio-proxy].image",
+			want: `{"spec":{"replicas":3,"template":{"spec":{"containers":[` +
+				`{"image":"app:1","name":"app","ports":[{"containerPort":8080,"protocol":"TCP"}]},` +
+				`{"name":"istio-proxy"}]}}}}`,
+		},
+		{
+			name: "selected list element",
+			path: "spec.template.spec.containers[name=istio-proxy]",
+			want: `{"spec":{"replicas":3,"template":{"spec":{"containers":[` +
+				`{"image":"app:1","name":"app","ports":[{"containerPort":8080,"protocol":"TCP"}]}]}}}}`,
+		},
+		{
+			name: "nested selectors with a number value",
+			path: "spec.template.spec.containers[name=app].ports[containerPort=8080].protocol",
+			want: `{"spec":{"replicas":3,"template":{"spec":{"containers":[` +
+				`{"image":"app:1","name":"app","ports":[{"containerPort":8080}]},` +
+				`{"image":"proxy:1","name":"istio-proxy"}]}}}}`,
+		},
+		{
+			name: "no selected list element",
+			path: "spec.template.spec.containers[name=missing].image",
+			want: `{"spec":{"replicas":3,"template":{"spec":{"containers":[` +
+				`{"image":"app:1","name":"app","ports":[{"containerPort":8080,"protocol":"TCP"}]},` +
+				`{"image":"proxy:1","name":"istio-proxy"}]}}}}`,
+		},
+		{
+			name: "selector on a field that is not a list",
+			path: "spec.replicas[name=app]",
+			want: `{"spec":{"replicas":3,"template":{"spec":{"containers":[` +
+				`{"image":"app:1","name":"app","ports":[{"containerPort":8080,"protocol":"TCP"}]},` +
+				`{"image":"proxy:1","name":"istio-proxy"}]}}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := removeFields([][]string{splitFieldPath(tt.path)}, []byte(doc), []byte(doc))
+			require.NoError(t, err)
+			require.Len(t, result, 2)
+			for _, got := range result {
+				assert.JSONEq(t, tt.want, string(got))
+			}
+		})
+	}
+}
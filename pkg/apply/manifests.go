@@ -0,0 +1,74 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/obot-platform/nah/pkg/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ApplyManifests decodes a stream of YAML or JSON documents, including List kinds, and applies the objects
+// with the same semantics as Apply. Objects whose kind is known to the scheme are converted to their typed
+// form, all other objects are applied as unstructured. The scope of each type is looked up when its objects
+// are applied, so the manifests may contain a CustomResourceDefinition and objects of that type.
+func (a apply) ApplyManifests(ctx context.Context, owner kclient.Object, manifests io.Reader) error {
+	objs, err := a.decodeManifests(manifests)
+	if err != nil {
+		return err
+	}
+	return a.Apply(ctx, owner, objs...)
+}
+
+func (a *apply) decodeManifests(manifests io.Reader) ([]kclient.Object, error) {
+	decoded, err := yaml.ToObjects(manifests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifests: %w", err)
+	}
+
+	result := make([]kclient.Object, 0, len(decoded))
+	for _, obj := range decoded {
+		ustr, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type %T decoding manifests", obj)
+		}
+
+		gvk := ustr.GroupVersionKind()
+		if gvk.Kind == "" || gvk.Version == "" {
+			return nil, fmt.Errorf("apiVersion and kind are required on object %s", logKey(ustr))
+		}
+
+		typed, err := a.fromUnstructured(ustr)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, typed)
+	}
+
+	return result, nil
+}
+
+// fromUnstructured converts the object to its typed form if the kind is known to the scheme.
+func (a *apply) fromUnstructured(ustr *unstructured.Unstructured) (kclient.Object, error) {
+	gvk := ustr.GroupVersionKind()
+	typed, err := a.client.Scheme().New(gvk)
+	if runtime.IsNotRegisteredError(err) {
+		return ustr, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(ustr.Object, typed); err != nil {
+		return nil, fmt.Errorf("failed to convert %s %s: %w", gvk, logKey(ustr), err)
+	}
+	typed.GetObjectKind().SetGroupVersionKind(gvk)
+
+	obj, ok := typed.(kclient.Object)
+	if !ok {
+		return nil, fmt.Errorf("type %T for %s is not an object", typed, gvk)
+	}
+	return obj, nil
+}
@@ -0,0 +1,93 @@
+package apply
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type EventType string
+
+const (
+	EventCreated         EventType = "Created"
+	EventPatched         EventType = "Patched"
+	EventUnchanged       EventType = "Unchanged"
+	EventDeleted         EventType = "Deleted"
+	EventReplaced        EventType = "Replaced"
+	EventConflict        EventType = "Conflict"
+	EventOwnerTransition EventType = "OwnerTransition"
+	EventTransformed     EventType = "Transformed"
+)
+
+// Event describes a single action taken by apply on an object.
+type Event struct {
+	Type      EventType
+	GVK       schema.GroupVersionKind
+	Namespace string
+	Name      string
+	// Object is the object that was acted on. For EventConflict and EventOwnerTransition this is the
+	// existing object in the cluster. It is nil for EventDeleted.
+	Object kclient.Object
+
+	Owner           kclient.Object
+	OwnerGVK        schema.GroupVersionKind
+	OwnerSubContext string
+	DebugID         string
+
+	// PatchType and Patch are set for EventPatched and EventTransformed, and sensitive fields in Patch are redacted.
+	// For EventPatched, Patch is empty if a reconciler handled the change. For EventTransformed, Patch is the JSON
+	// merge patch from the object before the transformer ran to the object after it.
+	PatchType types.PatchType
+	Patch     []byte
+
+	// PreviousSubContext is set for EventOwnerTransition and EventConflict to the sub context of the
+	// existing owner.
+	PreviousSubContext string
+	// Err is set for EventConflict
+	Err error
+	// Transformer is the name of the transformer that modified the object for EventTransformed
+	Transformer string
+}
+
+// Observer receives the events for each object that is processed by Apply. Objects may be applied in parallel,
+// see WithConcurrency, but the calls of one Apply are serialized, so an observer only used by one Apply at a time
+// doesn't need its own locking.
+type Observer interface {
+	OnApplyEvent(ctx context.Context, event Event)
+}
+
+type ObserverFunc func(ctx context.Context, event Event)
+
+func (o ObserverFunc) OnApplyEvent(ctx context.Context, event Event) {
+	o(ctx, event)
+}
+
+func (a *apply) observe(event Event) {
+	if len(a.observers) == 0 {
+		return
+	}
+
+	event.Owner = a.owner
+	event.OwnerGVK = a.ownerGVK
+	event.OwnerSubContext = a.ownerSubContext
+	if a.observeLock != nil {
+		a.observeLock.Lock()
+		defer a.observeLock.Unlock()
+	}
+	for _, observer := range a.observers {
+		observer.OnApplyEvent(a.ctx, event)
+	}
+}
+
+func objectEvent(eventType EventType, gvk schema.GroupVersionKind, debugID string, obj kclient.Object) Event {
+	return Event{
+		Type:      eventType,
+		GVK:       gvk,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Object:    obj,
+		DebugID:   debugID,
+	}
+}
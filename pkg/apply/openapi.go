@@ -0,0 +1,157 @@
+package apply
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/openapi3"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+const (
+	extGVK          = "x-kubernetes-group-version-kind"
+	extListType     = "x-kubernetes-list-type"
+	extListMapKeys  = "x-kubernetes-list-map-keys"
+	extPatchKey     = "x-kubernetes-patch-merge-key"
+	extPatchMerge   = "x-kubernetes-patch-strategy"
+	patchMergeValue = "merge"
+)
+
+var (
+	openAPIV3Root     openapi3.Root
+	openAPIV3RootLock sync.RWMutex
+)
+
+// OpenAPIV3RootProvider is implemented by clients that know the OpenAPI v3 schemas of the cluster they talk
+// to. New uses it to pick the schema source of the Apply instance.
+type OpenAPIV3RootProvider interface {
+	OpenAPIV3Root() openapi3.Root
+}
+
+// SetOpenAPIV3Root sets the default source of OpenAPI v3 schemas used to compute patches for types that are
+// not known to client-go, such as CRDs. Lists in these types are merged according to x-kubernetes-list-type
+// and x-kubernetes-list-map-keys instead of being replaced. The default is only used by Apply instances whose
+// client does not implement OpenAPIV3RootProvider and that were not given a root with WithOpenAPIV3Root.
+func SetOpenAPIV3Root(root openapi3.Root) {
+	openAPIV3RootLock.Lock()
+	openAPIV3Root = root
+	openAPIV3RootLock.Unlock()
+}
+
+func GetOpenAPIV3Root() openapi3.Root {
+	openAPIV3RootLock.RLock()
+	defer openAPIV3RootLock.RUnlock()
+	return openAPIV3Root
+}
+
+func (a apply) WithOpenAPIV3Root(root openapi3.Root) Apply {
+	a.openAPIV3Root = root
+	return a
+}
+
+func (a *apply) getOpenAPIV3Root() openapi3.Root {
+	if a.openAPIV3Root != nil {
+		return a.openAPIV3Root
+	}
+	return GetOpenAPIV3Root()
+}
+
+// openAPIV3PatchMeta returns the patch metadata for the GVK from the cluster's OpenAPI v3 document. A nil
+// result with no error means that no schema source is configured or that the document has no schema for the
+// GVK.
+func openAPIV3PatchMeta(root openapi3.Root, gvk schema.GroupVersionKind) (strategicpatch.LookupPatchMeta, error) {
+	if root == nil {
+		return nil, nil
+	}
+
+	doc, err := root.GVSpec(gvk.GroupVersion())
+	if err != nil {
+		return nil, err
+	}
+	if doc.Components == nil {
+		return nil, nil
+	}
+
+	for _, s := range doc.Components.Schemas {
+		if !hasGVK(s, gvk) {
+			continue
+		}
+		for _, s := range doc.Components.Schemas {
+			addListPatchExtensions(s)
+		}
+		return strategicpatch.PatchMetaFromOpenAPIV3{
+			SchemaList: doc.Components.Schemas,
+			Schema:     s,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+func hasGVK(s *spec.Schema, gvk schema.GroupVersionKind) bool {
+	gvks, _ := s.Extensions[extGVK].([]any)
+	for _, v := range gvks {
+		m, _ := v.(map[string]any)
+		if m["group"] == gvk.Group && m["version"] == gvk.Version && m["kind"] == gvk.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+// addListPatchExtensions translates the structural list extensions used by CRDs into the patch extensions
+// understood by strategicpatch.
+func addListPatchExtensions(s *spec.Schema) {
+	if s == nil {
+		return
+	}
+
+	if _, ok := s.Extensions[extPatchMerge]; !ok {
+		switch s.Extensions[extListType] {
+		case "set":
+			s.AddExtension(extPatchMerge, patchMergeValue)
+		case "map":
+			if keys, _ := s.Extensions[extListMapKeys].([]any); len(keys) == 1 {
+				if key, ok := keys[0].(string); ok {
+					s.AddExtension(extPatchMerge, patchMergeValue)
+					s.AddExtension(extPatchKey, key)
+				}
+			}
+		}
+	}
+
+	for k, prop := range s.Properties {
+		addListPatchExtensions(&prop)
+		s.Properties[k] = prop
+	}
+	for i := range s.AllOf {
+		addListPatchExtensions(&s.AllOf[i])
+	}
+	if s.Items != nil {
+		addListPatchExtensions(s.Items.Schema)
+		for i := range s.Items.Schemas {
+			addListPatchExtensions(&s.Items.Schemas[i])
+		}
+	}
+	if s.AdditionalProperties != nil {
+		addListPatchExtensions(s.AdditionalProperties.Schema)
+	}
+}
+
+// createSchemaMergePatch computes a three-way strategic merge using the schema and converts the result to a
+// JSON merge patch, because custom resources do not accept strategic merge patches.
+func createSchemaMergePatch(original, modified, current []byte, lookup strategicpatch.LookupPatchMeta) ([]byte, error) {
+	patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, current, lookup, true)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := strategicpatch.StrategicMergePatchUsingLookupPatchMeta(current, patch, lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonmergepatch.CreateThreeWayJSONMergePatch(current, merged, current)
+}
@@ -0,0 +1,133 @@
+package apply
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kube-openapi/pkg/spec3"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+const widgetOpenAPI = `{
+	"openapi": "3.0.0",
+	"info": {"title": "test", "version": "v1"},
+	"components": {"schemas": {
+		"com.example.v1.Widget": {
+			"type": "object",
+			"x-kubernetes-group-version-kind": [{"group": "example.com", "version": "v1", "kind": "Widget"}],
+			"properties": {"spec": {
+				"type": "object",
+				"properties": {
+					"ports": {
+						"type": "array",
+						"x-kubernetes-list-type": "map",
+						"x-kubernetes-list-map-keys": ["name"],
+						"items": {"type": "object", "properties": {
+							"name": {"type": "string"},
+							"port": {"type": "integer"}
+						}}
+					},
+					"tags": {
+						"type": "array",
+						"x-kubernetes-list-type": "set",
+						"items": {"type": "string"}
+					},
+					"args": {
+						"type": "array",
+						"x-kubernetes-list-type": "atomic",
+						"items": {"type": "string"}
+					}
+				}
+			}}
+		}
+	}}
+}`
+
+var widgetGVK = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+// testOpenAPIV3Root serves the same document for every group version.
+type testOpenAPIV3Root struct {
+	doc string
+}
+
+func (r testOpenAPIV3Root) GroupVersions() ([]schema.GroupVersion, error) {
+	return []schema.GroupVersion{widgetGVK.GroupVersion()}, nil
+}
+
+func (r testOpenAPIV3Root) GVSpec(schema.GroupVersion) (*spec3.OpenAPI, error) {
+	doc := &spec3.OpenAPI{}
+	return doc, json.Unmarshal([]byte(r.doc), doc)
+}
+
+func (r testOpenAPIV3Root) GVSpecAsMap(schema.GroupVersion) (map[string]any, error) {
+	result := map[string]any{}
+	return result, json.Unmarshal([]byte(r.doc), &result)
+}
+
+func TestOpenAPIV3PatchMetaNotFound(t *testing.T) {
+	lookup, err := openAPIV3PatchMeta(nil, widgetGVK)
+	require.NoError(t, err)
+	assert.Nil(t, lookup)
+
+	lookup, err = openAPIV3PatchMeta(testOpenAPIV3Root{doc: widgetOpenAPI}, widgetGVK.GroupVersion().WithKind("Gadget"))
+	require.NoError(t, err)
+	assert.Nil(t, lookup)
+}
+
+func TestCreateSchemaMergePatch(t *testing.T) {
+	lookup, err := openAPIV3PatchMeta(testOpenAPIV3Root{doc: widgetOpenAPI}, widgetGVK)
+	require.NoError(t, err)
+	require.NotNil(t, lookup)
+
+	original := `{"spec": {"ports": [{"name": "a", "port": 1}], "tags": ["x"], "args": ["1"]}}`
+	modified := `{"spec": {"ports": [{"name": "a", "port": 2}], "tags": ["x"], "args": ["2"]}}`
+	// Another writer added the b port and the y tag
+	current := `{"spec": {"ports": [{"name": "a", "port": 1}, {"name": "b", "port": 3}], "tags": ["x", "y"], "args": ["1"]}}`
+
+	patch, err := createSchemaMergePatch([]byte(original), []byte(modified), []byte(current), lookup)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"spec": {"ports": [{"name": "a", "port": 2}, {"name": "b", "port": 3}], "args": ["2"]}}`, string(patch))
+
+	// Items removed from the desired object are removed, items added by others are kept
+	modified = `{"spec": {"ports": [], "tags": [], "args": ["1"]}}`
+	patch, err = createSchemaMergePatch([]byte(original), []byte(modified), []byte(current), lookup)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"spec": {"ports": [{"name": "b", "port": 3}], "tags": ["y"]}}`, string(patch))
+}
+
+func TestAddListPatchExtensions(t *testing.T) {
+	list := func(extensions spec.Extensions) spec.Schema {
+		return spec.Schema{
+			VendorExtensible: spec.VendorExtensible{Extensions: extensions},
+			SchemaProps:      spec.SchemaProps{Type: []string{"array"}},
+		}
+	}
+	s := &spec.Schema{SchemaProps: spec.SchemaProps{
+		Properties: map[string]spec.Schema{
+			"map": list(spec.Extensions{extListType: "map", extListMapKeys: []any{"name"}}),
+			// strategicpatch only supports a single merge key
+			"multiKeyMap": list(spec.Extensions{extListType: "map", extListMapKeys: []any{"name", "protocol"}}),
+			"set":         list(spec.Extensions{extListType: "set"}),
+			"atomic":      list(spec.Extensions{extListType: "atomic"}),
+			"explicit": list(spec.Extensions{
+				extListType:    "map",
+				extListMapKeys: []any{"name"},
+				extPatchMerge:  "retainKeys",
+			}),
+		},
+	}}
+
+	addListPatchExtensions(s)
+
+	assert.Equal(t, patchMergeValue, s.Properties["map"].Extensions[extPatchMerge])
+	assert.Equal(t, "name", s.Properties["map"].Extensions[extPatchKey])
+	assert.NotContains(t, s.Properties["multiKeyMap"].Extensions, extPatchMerge)
+	assert.Equal(t, patchMergeValue, s.Properties["set"].Extensions[extPatchMerge])
+	assert.NotContains(t, s.Properties["set"].Extensions, extPatchKey)
+	assert.NotContains(t, s.Properties["atomic"].Extensions, extPatchMerge)
+	assert.Equal(t, "retainKeys", s.Properties["explicit"].Extensions[extPatchMerge])
+	assert.NotContains(t, s.Properties["explicit"].Extensions, extPatchKey)
+}
@@ -1,43 +1,89 @@
 package apply
 
 import (
+	"reflect"
 	"sync"
+	"time"
 
+	"github.com/obot-platform/nah/pkg/log"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/openapi3"
 )
 
 var (
-	patchCache     = map[schema.GroupVersionKind]patchCacheEntry{}
+	patchCache     = map[patchCacheKey]patchCacheEntry{}
 	patchCacheLock = sync.Mutex{}
 )
 
+const (
+	// schemaRetryInterval is how long a failed or empty lookup of an OpenAPI schema is cached before trying
+	// again. The schema of a CRD is published shortly after the CRD is created.
+	schemaRetryInterval = time.Minute
+	// schemaRefreshInterval is how long a schema found in the OpenAPI document is used before it is fetched
+	// again, so that changes to a CRD are eventually seen.
+	schemaRefreshInterval = 10 * time.Minute
+)
+
+// patchCacheKey includes the schema source because Apply instances may talk to different clusters. Types
+// known to client-go do not depend on the schema source and are cached with a nil root.
+type patchCacheKey struct {
+	root openapi3.Root
+	gvk  schema.GroupVersionKind
+}
+
 type patchCacheEntry struct {
 	patchType types.PatchType
 	lookup    strategicpatch.LookupPatchMeta
+	expires   time.Time
 }
 
-func getMergeStyle(gvk schema.GroupVersionKind) (types.PatchType, strategicpatch.LookupPatchMeta, error) {
+func getMergeStyle(root openapi3.Root, gvk schema.GroupVersionKind) (types.PatchType, strategicpatch.LookupPatchMeta, error) {
 	var (
 		patchType       types.PatchType
 		lookupPatchMeta strategicpatch.LookupPatchMeta
 	)
 
+	versionedObject, err := scheme.Scheme.New(gvk)
+	custom := runtime.IsNotRegisteredError(err) || gvk.Kind == "CustomResourceDefinition"
+
+	key := patchCacheKey{gvk: gvk}
+	if custom && root != nil && reflect.TypeOf(root).Comparable() {
+		key.root = root
+	}
+
 	patchCacheLock.Lock()
-	entry, ok := patchCache[gvk]
+	entry, ok := patchCache[key]
 	patchCacheLock.Unlock()
 
-	if ok {
+	if ok && (entry.expires.IsZero() || time.Now().Before(entry.expires)) {
 		return entry.patchType, entry.lookup, nil
 	}
 
-	versionedObject, err := scheme.Scheme.New(gvk)
-
-	if runtime.IsNotRegisteredError(err) || gvk.Kind == "CustomResourceDefinition" {
+	var expires time.Time
+	if custom {
+		// Custom resources only accept merge patches, but if a schema is available the lookup is used to
+		// merge lists before the patch is converted.
 		patchType = types.MergePatchType
+		if gvk.Kind != "CustomResourceDefinition" && root != nil {
+			lookupPatchMeta, err = openAPIV3PatchMeta(root, gvk)
+			if err != nil {
+				log.Debugf("DesiredSet - Failed to get OpenAPI v3 schema for %s: %v", gvk, err)
+				lookupPatchMeta = nil
+			}
+			if lookupPatchMeta == nil {
+				expires = time.Now().Add(schemaRetryInterval)
+			} else {
+				expires = time.Now().Add(schemaRefreshInterval)
+			}
+			if key.root == nil {
+				// Results of a schema source that cannot be used as a cache key are not cached
+				return patchType, lookupPatchMeta, nil
+			}
+		}
 	} else if err != nil {
 		return patchType, nil, err
 	} else {
@@ -49,9 +95,10 @@ func getMergeStyle(gvk schema.GroupVersionKind) (types.PatchType, strategicpatch
 	}
 
 	patchCacheLock.Lock()
-	patchCache[gvk] = patchCacheEntry{
+	patchCache[key] = patchCacheEntry{
 		patchType: patchType,
 		lookup:    lookupPatchMeta,
+		expires:   expires,
 	}
 	patchCacheLock.Unlock()
 
@@ -0,0 +1,130 @@
+package apply
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const redactedPrefix = "sha256:"
+
+var (
+	// sensitiveFields is the set of field paths per GVK whose values must never be stored in the applied
+	// annotation or written to logs. A path that refers to a map redacts every value in the map.
+	sensitiveFields = map[schema.GroupVersionKind][][]string{
+		corev1.SchemeGroupVersion.WithKind("Secret"): {
+			{"data"},
+			{"stringData"},
+		},
+	}
+	sensitiveFieldsLock sync.RWMutex
+)
+
+// AddSensitiveFields registers dot separated field paths, such as "spec.credentials", for the given GVK that
+// will be replaced with a hash in the applied annotation and in debug output.
+func AddSensitiveFields(gvk schema.GroupVersionKind, paths ...string) {
+	sensitiveFieldsLock.Lock()
+	defer sensitiveFieldsLock.Unlock()
+
+	for _, path := range paths {
+		sensitiveFields[gvk] = append(sensitiveFields[gvk], strings.Split(path, "."))
+	}
+}
+
+func sensitivePaths(gvk schema.GroupVersionKind) [][]string {
+	sensitiveFieldsLock.RLock()
+	defer sensitiveFieldsLock.RUnlock()
+	return sensitiveFields[gvk]
+}
+
+// redact replaces the values of all sensitive fields of the object in place.
+func redact(gvk schema.GroupVersionKind, data map[string]any) {
+	eachSensitiveField(gvk, data, func(parent map[string]any, field string) {
+		if v, ok := parent[field]; ok && v != nil {
+			parent[field] = redactValue(v)
+		}
+	})
+}
+
+// removeSensitive deletes all sensitive fields from the object in place. The redacted values are not
+// valid for the type, such as base64 encoded Secret data, so they are removed before decoding.
+func removeSensitive(gvk schema.GroupVersionKind, data map[string]any) {
+	eachSensitiveField(gvk, data, func(parent map[string]any, field string) {
+		delete(parent, field)
+	})
+}
+
+func eachSensitiveField(gvk schema.GroupVersionKind, data map[string]any, f func(parent map[string]any, field string)) {
+	eachField(data, sensitivePaths(gvk), f)
+}
+
+// eachField calls f with the parent map and field name of every path whose parent exists in data.
+func eachField(data map[string]any, paths [][]string, f func(parent map[string]any, field string)) {
+	for _, path := range paths {
+		parent := data
+		for _, field := range path[:len(path)-1] {
+			parent, _ = parent[field].(map[string]any)
+			if parent == nil {
+				break
+			}
+		}
+		if parent == nil {
+			continue
+		}
+		f(parent, path[len(path)-1])
+	}
+}
+
+func redactValue(v any) any {
+	if m, ok := v.(map[string]any); ok {
+		result := make(map[string]any, len(m))
+		for k, v := range m {
+			if v == nil {
+				// null removes the key in a patch, keep it as is
+				result[k] = nil
+			} else {
+				result[k] = redactValue(v)
+			}
+		}
+		return result
+	}
+
+	var b []byte
+	switch typed := v.(type) {
+	case string:
+		if strings.HasPrefix(typed, redactedPrefix) {
+			return typed
+		}
+		b = []byte(typed)
+	default:
+		b = []byte(fmt.Sprint(typed))
+	}
+	sum := sha256.Sum256(b)
+	return redactedPrefix + hex.EncodeToString(sum[:])
+}
+
+// redactJSON returns a copy of the JSON document with all sensitive fields redacted. It is used for
+// debug output so any error results in the document being omitted.
+func redactJSON(gvk schema.GroupVersionKind, b []byte) []byte {
+	if len(sensitivePaths(gvk)) == 0 {
+		return b
+	}
+
+	data := map[string]any{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return []byte("<redacted>")
+	}
+	redact(gvk, data)
+
+	result, err := json.Marshal(data)
+	if err != nil {
+		return []byte("<redacted>")
+	}
+	return result
+}
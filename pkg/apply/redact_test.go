@@ -0,0 +1,92 @@
+package apply
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func sha(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return redactedPrefix + hex.EncodeToString(sum[:])
+}
+
+func TestRedactValue(t *testing.T) {
+	assert.Equal(t, sha("secret"), redactValue("secret"))
+	assert.Equal(t, sha("3"), redactValue(int64(3)))
+	assert.Equal(t, sha("true"), redactValue(true))
+	// Values that are already redacted are kept, so redacting twice gives the same result
+	assert.Equal(t, sha("secret"), redactValue(sha("secret")))
+	assert.Equal(t, map[string]any{
+		"a": sha("1"),
+		"b": nil,
+		"c": map[string]any{"d": sha("2")},
+	}, redactValue(map[string]any{
+		"a": "1",
+		"b": nil,
+		"c": map[string]any{"d": "2"},
+	}))
+}
+
+func TestRedactSecret(t *testing.T) {
+	secret := map[string]any{
+		"metadata":   map[string]any{"name": "a"},
+		"type":       "Opaque",
+		"data":       map[string]any{"password": "cGFzc3dvcmQ=", "removed": nil},
+		"stringData": map[string]any{"token": "token"},
+	}
+	redact(corev1.SchemeGroupVersion.WithKind("Secret"), secret)
+	assert.Equal(t, map[string]any{
+		"metadata":   map[string]any{"name": "a"},
+		"type":       "Opaque",
+		"data":       map[string]any{"password": sha("cGFzc3dvcmQ="), "removed": nil},
+		"stringData": map[string]any{"token": sha("token")},
+	}, secret)
+
+	removeSensitive(corev1.SchemeGroupVersion.WithKind("Secret"), secret)
+	assert.Equal(t, map[string]any{
+		"metadata": map[string]any{"name": "a"},
+		"type":     "Opaque",
+	}, secret)
+}
+
+func TestAddSensitiveFields(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "redact.example.com", Version: "v1", Kind: "Credentials"}
+	AddSensitiveFields(gvk, "spec.password", "spec.auth.token", "status.missing.value")
+
+	obj := map[string]any{
+		"spec": map[string]any{
+			"user":     "admin",
+			"password": "password",
+			"auth":     map[string]any{"token": "token", "type": "bearer"},
+		},
+		"status": map[string]any{"ready": true},
+	}
+	redact(gvk, obj)
+	assert.Equal(t, map[string]any{
+		"spec": map[string]any{
+			"user":     "admin",
+			"password": sha("password"),
+			"auth":     map[string]any{"token": sha("token"), "type": "bearer"},
+		},
+		"status": map[string]any{"ready": true},
+	}, obj)
+
+	// Other kinds of the group aren't redacted
+	other := map[string]any{"spec": map[string]any{"password": "password"}}
+	redact(gvk.GroupVersion().WithKind("Other"), other)
+	assert.Equal(t, "password", other["spec"].(map[string]any)["password"])
+}
+
+func TestRedactJSON(t *testing.T) {
+	secretGVK := corev1.SchemeGroupVersion.WithKind("Secret")
+	configMap := []byte(`{"data":{"key":"value"}}`)
+
+	assert.Equal(t, configMap, redactJSON(corev1.SchemeGroupVersion.WithKind("ConfigMap"), configMap))
+	assert.JSONEq(t, `{"data":{"key":"`+sha("value")+`"}}`, string(redactJSON(secretGVK, configMap)))
+	assert.Equal(t, "<redacted>", string(redactJSON(secretGVK, []byte(`{"data":`))))
+}
@@ -0,0 +1,434 @@
+package apply
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/obot-platform/nah/pkg/apply/objectset"
+	"github.com/obot-platform/nah/pkg/log"
+	"github.com/obot-platform/nah/pkg/name"
+	"github.com/obot-platform/nah/pkg/untriggered"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	LabelRevisionsFor = LabelPrefix + "revisions-for"
+
+	revisionKeyPrefix = "revision-"
+	// maxHistorySize is the most revision data stored in one Secret or ConfigMap, below the 1MiB limit of the
+	// API server to leave room for the metadata
+	maxHistorySize = 1024*1024 - 32*1024
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+type RevisionStorage string
+
+const (
+	// RevisionStorageSecret stores the revisions as they were applied, so that any of them can be rolled back
+	RevisionStorageSecret RevisionStorage = "Secret"
+	// RevisionStorageConfigMap stores the revisions with the data of Secrets and other sensitive fields redacted.
+	// These revisions can be listed but not rolled back.
+	RevisionStorageConfigMap RevisionStorage = "ConfigMap"
+)
+
+// RevisionHistory configures keeping the last applied object sets of an owner so they can be rolled back.
+type RevisionHistory struct {
+	// Limit is the number of revisions to keep. Zero disables the history. Older revisions are also dropped to
+	// keep the history below the size limit of a Secret or ConfigMap.
+	Limit int
+	// Namespace the history is stored in. Defaults to the namespace of the owner, or the default namespace
+	// of the apply for cluster scoped owners.
+	Namespace string
+	// Storage is the type of object the history is stored in, defaults to a Secret. The values of sensitive
+	// fields are redacted when stored in a ConfigMap, so those revisions can't be rolled back.
+	Storage RevisionStorage
+}
+
+// RevisionInfo describes a stored revision and how it differs from the revision before it.
+type RevisionInfo struct {
+	Revision  int64
+	Timestamp time.Time
+	Hash      string
+	Redacted  bool
+	Added     []string
+	Removed   []string
+	Changed   []string
+}
+
+type storedRevision struct {
+	Revision  int64            `json:"revision"`
+	Timestamp metav1.Time      `json:"timestamp"`
+	Hash      string           `json:"hash"`
+	Redacted  bool             `json:"redacted,omitempty"`
+	Objects   []map[string]any `json:"objects"`
+}
+
+// WithRevisionHistory keeps the last applied object sets per owner and sub context. Applies without an owner or
+// sub context have no history. By default the history is a Secret that holds the desired objects as they were
+// applied, including the data of Secrets, so access to it must be restricted like access to those Secrets. The history
+// is read from the API server, not the cache, and a conflicting write of the history is logged instead of failing the
+// apply.
+func (a apply) WithRevisionHistory(history RevisionHistory) Apply {
+	a.history = history
+	return a
+}
+
+// ListRevisions returns the stored revisions of the owner, oldest first. The history must have the Namespace and
+// Storage the revisions were recorded with.
+func (a apply) ListRevisions(ctx context.Context, owner kclient.Object, history RevisionHistory) ([]RevisionInfo, error) {
+	a.ctx = ctx
+	a.owner = owner
+	a.history = history
+
+	revisions, _, err := a.loadRevisions()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]RevisionInfo, 0, len(revisions))
+	var previous *storedRevision
+	for i := range revisions {
+		info := RevisionInfo{
+			Revision:  revisions[i].Revision,
+			Timestamp: revisions[i].Timestamp.Time,
+			Hash:      revisions[i].Hash,
+			Redacted:  revisions[i].Redacted,
+		}
+		info.Added, info.Removed, info.Changed = diffRevisions(previous, &revisions[i])
+		result = append(result, info)
+		previous = &revisions[i]
+	}
+
+	return result, nil
+}
+
+// Rollback applies the objects of a stored revision. Objects of types in the latest revision that are not in
+// the stored revision are pruned. Transformers are not run again because the stored objects already include
+// their changes. The history must have the Namespace and Storage the revisions were recorded with. If it has a
+// Limit, the rollback is recorded as a new revision.
+func (a apply) Rollback(ctx context.Context, owner kclient.Object, history RevisionHistory, revision int64) error {
+	a.ctx = ctx
+	a.owner = owner
+	a.history = history
+
+	revisions, _, err := a.loadRevisions()
+	if err != nil {
+		return err
+	}
+
+	var target *storedRevision
+	for i := range revisions {
+		if revisions[i].Revision == revision {
+			target = &revisions[i]
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("%w: %d for %s", ErrRevisionNotFound, revision, a.debugID())
+	}
+	if target.Redacted {
+		return fmt.Errorf("revision %d for %s contains redacted values and can not be rolled back", revision, a.debugID())
+	}
+
+	var pruneGVKs []schema.GroupVersionKind
+	if len(revisions) > 0 {
+		for _, obj := range revisions[len(revisions)-1].Objects {
+			pruneGVKs = append(pruneGVKs, (&unstructured.Unstructured{Object: obj}).GroupVersionKind())
+		}
+	}
+
+	objs := make([]kclient.Object, 0, len(target.Objects))
+	for _, data := range target.Objects {
+		obj, err := a.fromUnstructured(&unstructured.Unstructured{Object: data})
+		if err != nil {
+			return err
+		}
+		objs = append(objs, obj)
+	}
+
+	a = a.withPruneGVKs(pruneGVKs...)
+	a.transformers = nil
+	return a.Apply(ctx, owner, objs...)
+}
+
+func (a *apply) historyKey() (namespace, historyName, hash string, err error) {
+	labelSet, _, err := GetLabelsAndAnnotations(a.client.Scheme(), a.ownerSubContext, a.owner)
+	if err != nil {
+		return "", "", "", err
+	}
+	if len(labelSet) == 0 {
+		return "", "", "", fmt.Errorf("an owner or sub context is required for revision history")
+	}
+
+	namespace = a.history.Namespace
+	if namespace == "" && a.owner != nil {
+		namespace = a.owner.GetNamespace()
+	}
+	if namespace == "" {
+		namespace = a.defaultNamespace
+	}
+
+	hash = labelSet[LabelHash]
+	return namespace, name.SafeConcatName("apply-revisions", hash), hash, nil
+}
+
+func (a *apply) newHistoryObject() kclient.Object {
+	if a.history.Storage == RevisionStorageConfigMap {
+		return &corev1.ConfigMap{}
+	}
+	return &corev1.Secret{}
+}
+
+func historyData(obj kclient.Object) map[string][]byte {
+	switch typed := obj.(type) {
+	case *corev1.ConfigMap:
+		return typed.BinaryData
+	case *corev1.Secret:
+		return typed.Data
+	}
+	return nil
+}
+
+func setHistoryData(obj kclient.Object, data map[string][]byte) {
+	switch typed := obj.(type) {
+	case *corev1.ConfigMap:
+		typed.BinaryData = data
+	case *corev1.Secret:
+		typed.Data = data
+	}
+}
+
+// loadRevisions returns the stored revisions sorted by revision number and the object they are stored in. The
+// object is nil if no history exists.
+func (a *apply) loadRevisions() ([]storedRevision, kclient.Object, error) {
+	namespace, historyName, _, err := a.historyKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj := a.newHistoryObject()
+	// Read uncached, so that the history doesn't start a cache of every Secret or ConfigMap and isn't stale
+	if err := a.client.Get(a.ctx, kclient.ObjectKey{Namespace: namespace, Name: historyName}, untriggered.UncachedGet(obj)); apierrors.IsNotFound(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failed to get revision history for %s: %w", a.debugID(), err)
+	}
+
+	var revisions []storedRevision
+	for k, v := range historyData(obj) {
+		if !strings.HasPrefix(k, revisionKeyPrefix) {
+			continue
+		}
+		var rev storedRevision
+		if err := json.Unmarshal(appliedFromAnnotation(string(v)), &rev); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode revision %s for %s: %w", k, a.debugID(), err)
+		}
+		revisions = append(revisions, rev)
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+	return revisions, obj, nil
+}
+
+// recordRevision stores the object set as a new revision if it differs from the latest revision.
+func (a *apply) recordRevision(objs *objectset.ObjectSet) error {
+	if a.owner == nil && a.ownerSubContext == "" {
+		// There is nothing to key the history by
+		return nil
+	}
+
+	redacted := a.history.Storage == RevisionStorageConfigMap
+	objects, err := a.revisionObjects(objs, redacted)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(objects)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	revisions, existing, err := a.loadRevisions()
+	if err != nil {
+		return err
+	}
+
+	var next int64 = 1
+	if len(revisions) > 0 {
+		latest := revisions[len(revisions)-1]
+		if latest.Hash == hash {
+			return nil
+		}
+		next = latest.Revision + 1
+	}
+
+	revisions = append(revisions, storedRevision{
+		Revision:  next,
+		Timestamp: metav1.Now(),
+		Hash:      hash,
+		Redacted:  redacted,
+		Objects:   objects,
+	})
+	if len(revisions) > a.history.Limit {
+		revisions = revisions[len(revisions)-a.history.Limit:]
+	}
+
+	data := make(map[string][]byte, len(revisions))
+	size := 0
+	// the newest revisions are kept if they don't all fit
+	for i := len(revisions) - 1; i >= 0; i-- {
+		b, err := json.Marshal(revisions[i])
+		if err != nil {
+			return err
+		}
+		key := revisionKeyPrefix + strconv.FormatInt(revisions[i].Revision, 10)
+		value := appliedToAnnotation(b)
+		if size+len(key)+len(value) > maxHistorySize {
+			if i == len(revisions)-1 {
+				return fmt.Errorf("revision %d for %s is %d bytes, which is too large to store", revisions[i].Revision, a.debugID(), len(value))
+			}
+			break
+		}
+		size += len(key) + len(value)
+		data[key] = []byte(value)
+	}
+
+	if existing != nil {
+		setHistoryData(existing, data)
+		if err := a.client.Update(a.ctx, existing); apierrors.IsConflict(err) {
+			// The objects were applied, the revision is recorded by the next apply
+			log.Infof("Skipping revision %d for %s, the history was changed concurrently: %v", next, a.debugID(), err)
+		} else if err != nil {
+			return fmt.Errorf("failed to update revision history for %s: %w", a.debugID(), err)
+		}
+		return nil
+	}
+
+	namespace, historyName, ownerHash, err := a.historyKey()
+	if err != nil {
+		return err
+	}
+
+	obj := a.newHistoryObject()
+	obj.SetNamespace(namespace)
+	obj.SetName(historyName)
+	obj.SetLabels(map[string]string{
+		LabelRevisionsFor: ownerHash,
+	})
+	if err := a.setHistoryOwner(obj); err != nil {
+		return err
+	}
+	setHistoryData(obj, data)
+
+	if err := a.client.Create(a.ctx, obj); apierrors.IsAlreadyExists(err) {
+		log.Infof("Skipping revision %d for %s, the history was created concurrently: %v", next, a.debugID(), err)
+	} else if err != nil {
+		return fmt.Errorf("failed to create revision history for %s: %w", a.debugID(), err)
+	}
+	return nil
+}
+
+// setHistoryOwner makes the owner the owner of the history, if possible, so that it is deleted with the owner.
+func (a *apply) setHistoryOwner(obj kclient.Object) error {
+	if a.owner == nil || a.owner.GetUID() == "" {
+		return nil
+	}
+
+	if nsed, err := a.IsNamespaced(a.ownerGVK); err != nil {
+		return err
+	} else if nsed && a.owner.GetNamespace() != obj.GetNamespace() {
+		return nil
+	}
+
+	obj.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: a.ownerGVK.GroupVersion().String(),
+		Kind:       a.ownerGVK.Kind,
+		Name:       a.owner.GetName(),
+		UID:        a.owner.GetUID(),
+	}})
+	return nil
+}
+
+func (a *apply) revisionObjects(objs *objectset.ObjectSet, redacted bool) ([]map[string]any, error) {
+	var result []map[string]any
+	for gvk, objMap := range objs.ObjectsByGVK() {
+		for _, obj := range objMap {
+			b, err := json.Marshal(obj)
+			if err != nil {
+				return nil, err
+			}
+			data := map[string]any{}
+			if err := json.Unmarshal(b, &data); err != nil {
+				return nil, err
+			}
+
+			removeMetadataFields(data)
+			delete(data, "status")
+			data["apiVersion"], data["kind"] = gvk.ToAPIVersionAndKind()
+			if redacted {
+				redact(gvk, data)
+			}
+			result = append(result, data)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return revisionObjectKey(result[i]) < revisionObjectKey(result[j])
+	})
+	return result, nil
+}
+
+func revisionObjectKey(data map[string]any) string {
+	ustr := &unstructured.Unstructured{Object: data}
+	return fmt.Sprintf("%s %s", ustr.GroupVersionKind(), logKey(ustr))
+}
+
+func diffRevisions(previous, current *storedRevision) (added, removed, changed []string) {
+	before := map[string]map[string]any{}
+	if previous != nil {
+		for _, obj := range previous.Objects {
+			before[revisionObjectKey(obj)] = obj
+		}
+	}
+
+	for _, obj := range current.Objects {
+		key := revisionObjectKey(obj)
+		old, ok := before[key]
+		if !ok {
+			added = append(added, key)
+			continue
+		}
+		delete(before, key)
+
+		oldBytes, _ := json.Marshal(old)
+		newBytes, _ := json.Marshal(obj)
+		if !bytes.Equal(oldBytes, newBytes) {
+			changed = append(changed, key)
+		}
+	}
+
+	for key := range before {
+		removed = append(removed, key)
+	}
+	sort.Strings(removed)
+
+	return
+}
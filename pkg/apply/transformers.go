@@ -0,0 +1,226 @@
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/obot-platform/nah/pkg/apply/objectset"
+	"github.com/obot-platform/nah/pkg/log"
+	"github.com/obot-platform/nah/pkg/name"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Transformer modifies objects after the apply labels and annotations are injected and before they are
+// compared to the existing objects. Transform modifies the object in place.
+type Transformer interface {
+	Name() string
+	Transform(gvk schema.GroupVersionKind, obj kclient.Object) error
+}
+
+type transformerFunc struct {
+	name string
+	f    func(gvk schema.GroupVersionKind, obj kclient.Object) error
+}
+
+func (t transformerFunc) Name() string {
+	return t.name
+}
+
+func (t transformerFunc) Transform(gvk schema.GroupVersionKind, obj kclient.Object) error {
+	return t.f(gvk, obj)
+}
+
+// NewTransformer returns a Transformer with the given name, used in debug output and events, that calls f.
+func NewTransformer(name string, f func(gvk schema.GroupVersionKind, obj kclient.Object) error) Transformer {
+	return transformerFunc{name: name, f: f}
+}
+
+// WithTransformers adds transformers that are run, in order, on every object.
+func (a apply) WithTransformers(transformers ...Transformer) Apply {
+	a.transformers = append(a.transformers[:len(a.transformers):len(a.transformers)], transformers...)
+	return a
+}
+
+func (a *apply) transform(debugID string, in *objectset.ObjectSet) (*objectset.ObjectSet, error) {
+	if len(a.transformers) == 0 {
+		return in, nil
+	}
+
+	result, err := objectset.NewObjectSet(a.client.Scheme())
+	if err != nil {
+		return nil, err
+	}
+
+	for gvk, objMap := range in.ObjectsByGVK() {
+		for key, obj := range objMap {
+			for _, t := range a.transformers {
+				before := obj.DeepCopyObject()
+				if err := t.Transform(gvk, obj); err != nil {
+					return nil, fmt.Errorf("transformer %s failed for %s %s for %s: %w", t.Name(), gvk, key, debugID, err)
+				}
+				if !equality.Semantic.DeepEqual(before, obj) {
+					patch, err := transformPatch(gvk, before, obj)
+					if err != nil {
+						return nil, fmt.Errorf("failed to compute change of transformer %s for %s %s for %s: %w", t.Name(), gvk, key, debugID, err)
+					}
+					log.Debugf("DesiredSet - Transformer %s modified %s %s for %s -- %s", t.Name(), gvk, key, debugID, patch)
+					event := objectEvent(EventTransformed, gvk, debugID, obj)
+					event.Transformer = t.Name()
+					event.PatchType = types.MergePatchType
+					event.Patch = patch
+					a.observe(event)
+				}
+			}
+
+			newKey := objectset.ObjectKey{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+			if result.Contains(gvk.GroupKind(), newKey) {
+				return nil, fmt.Errorf("transformers produced duplicate object %s %s for %s", gvk, newKey, debugID)
+			}
+			if err := result.Add(obj); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// transformPatch returns the JSON merge patch from before to after, with sensitive fields redacted.
+func transformPatch(gvk schema.GroupVersionKind, before, after runtime.Object) ([]byte, error) {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return nil, err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(beforeJSON, afterJSON, beforeJSON)
+	if err != nil {
+		return nil, err
+	}
+	return redactJSON(gvk, patch), nil
+}
+
+// CommonLabels returns a Transformer that adds the labels to every object. Existing values are overwritten
+// but labels used by apply can not be changed.
+func CommonLabels(labels map[string]string) Transformer {
+	return NewTransformer("common-labels", func(_ schema.GroupVersionKind, obj kclient.Object) error {
+		obj.SetLabels(mergeCommon(obj.GetLabels(), labels))
+		return nil
+	})
+}
+
+// CommonAnnotations returns a Transformer that adds the annotations to every object. Existing values are
+// overwritten but annotations used by apply can not be changed.
+func CommonAnnotations(annotations map[string]string) Transformer {
+	return NewTransformer("common-annotations", func(_ schema.GroupVersionKind, obj kclient.Object) error {
+		obj.SetAnnotations(mergeCommon(obj.GetAnnotations(), annotations))
+		return nil
+	})
+}
+
+func mergeCommon(existing, common map[string]string) map[string]string {
+	if existing == nil {
+		existing = make(map[string]string, len(common))
+	}
+	for k, v := range common {
+		if strings.HasPrefix(k, LabelPrefix) {
+			continue
+		}
+		existing[k] = v
+	}
+	return existing
+}
+
+// NamespaceOverride returns a Transformer that sets the namespace of every object. The namespace of
+// cluster scoped objects is cleared when they are processed.
+func NamespaceOverride(namespace string) Transformer {
+	return NewTransformer("namespace-override", func(_ schema.GroupVersionKind, obj kclient.Object) error {
+		obj.SetNamespace(namespace)
+		return nil
+	})
+}
+
+// NamePrefixSuffix returns a Transformer that adds a prefix and/or suffix to the name of every object. The
+// parts are joined with "-" and the result is shortened with a hash if it is too long.
+func NamePrefixSuffix(prefix, suffix string) Transformer {
+	return NewTransformer("name-prefix-suffix", func(_ schema.GroupVersionKind, obj kclient.Object) error {
+		var parts []string
+		if prefix != "" {
+			parts = append(parts, prefix)
+		}
+		parts = append(parts, obj.GetName())
+		if suffix != "" {
+			parts = append(parts, suffix)
+		}
+		obj.SetName(name.SafeConcatName(parts...))
+		return nil
+	})
+}
+
+// ReplaceImageRegistry returns an image rewrite function for ImageRewrite that replaces the registry prefix
+// from with to.
+func ReplaceImageRegistry(from, to string) func(image string) string {
+	from = strings.TrimSuffix(from, "/") + "/"
+	to = strings.TrimSuffix(to, "/") + "/"
+	return func(image string) string {
+		if rest, ok := strings.CutPrefix(image, from); ok {
+			return to + rest
+		}
+		return image
+	}
+}
+
+// ImageRewrite returns a Transformer that calls rewrite for the image of every container, init container, and
+// ephemeral container found in the object, including in pod templates of workloads and custom resources.
+func ImageRewrite(rewrite func(image string) string) Transformer {
+	return NewTransformer("image-rewrite", func(_ schema.GroupVersionKind, obj kclient.Object) error {
+		if ustr, ok := obj.(*unstructured.Unstructured); ok {
+			rewriteImages(ustr.Object, rewrite)
+			return nil
+		}
+
+		data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return err
+		}
+		if !rewriteImages(data, rewrite) {
+			return nil
+		}
+		return runtime.DefaultUnstructuredConverter.FromUnstructured(data, obj)
+	})
+}
+
+func rewriteImages(data map[string]any, rewrite func(string) string) bool {
+	var changed bool
+	for k, v := range data {
+		switch typed := v.(type) {
+		case map[string]any:
+			changed = rewriteImages(typed, rewrite) || changed
+		case []any:
+			isContainers := k == "containers" || k == "initContainers" || k == "ephemeralContainers"
+			for _, item := range typed {
+				m, ok := item.(map[string]any)
+				if !ok {
+					continue
+				}
+				if image, ok := m["image"].(string); ok && isContainers {
+					if newImage := rewrite(image); newImage != image {
+						m["image"] = newImage
+						changed = true
+					}
+				}
+				changed = rewriteImages(m, rewrite) || changed
+			}
+		}
+	}
+	return changed
+}
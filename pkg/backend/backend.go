@@ -20,6 +20,14 @@ type Watcher interface {
 	Watcher(ctx context.Context, gvk schema.GroupVersionKind, name string, cb Callback) error
 }
 
+// WatcherRemover is implemented by backends that can stop watching a GVK. The GVKs watched with other backends are
+// watched until the backend stops.
+type WatcherRemover interface {
+	// RemoveWatcher stops calling the callback of the named watcher. Informers are removed when a GVK has no
+	// more watchers, even if cached reads of the client use them, in which case the next read starts a new informer.
+	RemoveWatcher(ctx context.Context, gvk schema.GroupVersionKind, name string) error
+}
+
 type Backend interface {
 	Trigger
 	CacheFactory
@@ -32,6 +40,76 @@ type Backend interface {
 	GVKForObject(obj runtime.Object, scheme *runtime.Scheme) (schema.GroupVersionKind, error)
 }
 
+// MetadataOnly is implemented by backends that can watch only the metadata of some GVKs. Objects of GVKs that
+// a backend without it watches are always full objects.
+type MetadataOnly interface {
+	// IsMetadataOnly returns true if only the metadata of the GVK is watched, in which case the objects are
+	// *metav1.PartialObjectMetadata.
+	IsMetadataOnly(gvk schema.GroupVersionKind) bool
+}
+
+// MetadataOnlyWatcher is implemented by backends that can watch only the metadata of a GVK that is not configured to
+// be metadata only.
+type MetadataOnlyWatcher interface {
+	// SetMetadataOnly watches only the metadata of the GVK, if it is not watched yet. It returns true if only the
+	// metadata of the GVK is watched.
+	SetMetadataOnly(gvk schema.GroupVersionKind) bool
+}
+
+// ParkedKey is a key that failed more than the maximum attempts of its GVK and is not retried.
+type ParkedKey struct {
+	GVK schema.GroupVersionKind `json:"gvk"`
+	// Key is the namespace/name of the object
+	Key string `json:"key"`
+	// ResourceVersion is the resourceVersion of the object when it was parked. The key is released when the
+	// object has a different resourceVersion.
+	ResourceVersion string    `json:"resourceVersion,omitempty"`
+	Attempts        int       `json:"attempts"`
+	Error           string    `json:"error"`
+	Since           time.Time `json:"since"`
+}
+
+// DeadLetters is implemented by backends that stop retrying keys that failed too many times.
+type DeadLetters interface {
+	// ParkedKeys returns the keys that are not retried because they failed too many times.
+	ParkedKeys() []ParkedKey
+	// ReleaseParked enqueues the parked key of the GVK again. It returns false if the key was not parked.
+	ReleaseParked(ctx context.Context, gvk schema.GroupVersionKind, key string) (bool, error)
+}
+
+// Admin is implemented by backends that let operators enqueue keys, clear their backoff and pause GVKs.
+type Admin interface {
+	// Enqueue enqueues the key of the GVK to be handled as if the object changed.
+	Enqueue(ctx context.Context, gvk schema.GroupVersionKind, key string) error
+	// ClearBackoff forgets the failures of the key of the GVK, so that it is not delayed when it is retried.
+	ClearBackoff(ctx context.Context, gvk schema.GroupVersionKind, key string) error
+	// Pause stops handling keys of the GVK. The keys enqueued while paused are handled when it is resumed.
+	Pause(ctx context.Context, gvk schema.GroupVersionKind) error
+	// Resume handles the keys of the GVK again, starting with the keys enqueued while it was paused.
+	Resume(ctx context.Context, gvk schema.GroupVersionKind) error
+	// PausedGVKs returns the GVKs that are paused.
+	PausedGVKs() []schema.GroupVersionKind
+}
+
+// DrainStatus is the state of the workqueue of a GVK when its controller stopped.
+type DrainStatus struct {
+	GVK schema.GroupVersionKind `json:"gvk"`
+	// Drained is false if keys were still being handled when the drain timed out
+	Drained bool `json:"drained"`
+	// InFlight are the keys that were still being handled when the drain timed out
+	InFlight []string `json:"inFlight,omitempty"`
+	// Pending are the keys that were queued but not handled before the controller stopped
+	Pending []string `json:"pending,omitempty"`
+}
+
+// Drainer is implemented by backends that can wait for the keys being handled when they stop.
+type Drainer interface {
+	// Drain waits for the controllers of the GVKs, which stop when the context they were started with is done, to
+	// finish the keys they are handling. It stops waiting when ctx is done and returns the status of each controller.
+	// If no GVKs are given, every controller is drained.
+	Drain(ctx context.Context, gvks ...schema.GroupVersionKind) []DrainStatus
+}
+
 type CacheFactory interface {
 	GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind) (cache.SharedIndexInformer, error)
 }
@@ -0,0 +1,270 @@
+package router
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/obot-platform/nah/pkg/backend"
+	"github.com/obot-platform/nah/pkg/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// admin returns the admin operations of the backend, or an error if it doesn't implement them.
+func (r *Router) admin() (backend.Admin, error) {
+	if admin, ok := r.handlers.backend.(backend.Admin); ok {
+		return admin, nil
+	}
+	return nil, fmt.Errorf("backend %T does not support admin operations", r.handlers.backend)
+}
+
+// Enqueue handles the key, the namespace/name of an object of the GVK, as if the object changed.
+func (r *Router) Enqueue(ctx context.Context, gvk schema.GroupVersionKind, key string) error {
+	admin, err := r.admin()
+	if err != nil {
+		return err
+	}
+	return admin.Enqueue(ctx, gvk, key)
+}
+
+// EnqueueSelector handles every object of the GVK in the namespace, or all namespaces if it is empty, that matches
+// the selector as if it changed. A nil selector matches everything. It returns the number of keys enqueued.
+func (r *Router) EnqueueSelector(ctx context.Context, gvk schema.GroupVersionKind, namespace string, selector labels.Selector) (int, error) {
+	admin, err := r.admin()
+	if err != nil {
+		return 0, err
+	}
+
+	list, err := r.handlers.newObjectList(gvk)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := r.handlers.backend.List(ctx, list, &kclient.ListOptions{
+		Namespace:     namespace,
+		LabelSelector: selector,
+	}); err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = meta.EachListItem(list, func(item runtime.Object) error {
+		obj, ok := item.(kclient.Object)
+		if !ok {
+			return nil
+		}
+		count++
+		return admin.Enqueue(ctx, gvk, toKey(obj.GetNamespace(), obj.GetName()))
+	})
+	return count, err
+}
+
+// ClearBackoff forgets the failures of the key of the GVK, both the rate limit of the router and the backoff of
+// the workqueue, and enqueues the key to be handled now.
+func (r *Router) ClearBackoff(ctx context.Context, gvk schema.GroupVersionKind, key string) error {
+	admin, err := r.admin()
+	if err != nil {
+		return err
+	}
+
+	r.handlers.limiterLock.Lock()
+	delete(r.handlers.limiters, limiterKey{key: key, gvk: gvk})
+	delete(r.handlers.waiting, limiterKey{key: key, gvk: gvk})
+	r.handlers.limiterLock.Unlock()
+
+	if err := admin.ClearBackoff(ctx, gvk, key); err != nil {
+		return err
+	}
+	return admin.Enqueue(ctx, gvk, key)
+}
+
+// Pause stops handling objects of the GVK. Changes while paused are handled when it is resumed. The controller of
+// the GVK is shared by every router with the same backend, so the GVK is paused in all of them, not only in this
+// router.
+func (r *Router) Pause(ctx context.Context, gvk schema.GroupVersionKind) error {
+	admin, err := r.admin()
+	if err != nil {
+		return err
+	}
+	log.Infof("Pausing handlers of [%v]", gvk)
+	return admin.Pause(ctx, gvk)
+}
+
+// Resume handles the objects of the GVK again, starting with the changes while it was paused. Like Pause, it
+// applies to every router with the same backend.
+func (r *Router) Resume(ctx context.Context, gvk schema.GroupVersionKind) error {
+	admin, err := r.admin()
+	if err != nil {
+		return err
+	}
+	log.Infof("Resuming handlers of [%v]", gvk)
+	return admin.Resume(ctx, gvk)
+}
+
+// PausedGVKs returns the GVKs that are paused.
+func (r *Router) PausedGVKs() []schema.GroupVersionKind {
+	if admin, ok := r.handlers.backend.(backend.Admin); ok {
+		return admin.PausedGVKs()
+	}
+	return nil
+}
+
+// EnableAdmin serves the admin endpoints of the router on the healthz server. Requests must have the token as
+// a bearer token in the Authorization header. The endpoints take the router name as the router query parameter
+// and the GVK as the apiVersion and kind query parameters:
+//
+//	POST /admin/enqueue?key=                  enqueue a key
+//	POST /admin/enqueue?namespace=&selector=  enqueue every object matching the label selector
+//	POST /admin/backoff/clear?key=            clear the backoff of a key and enqueue it
+//	POST /admin/pause                         pause the GVK
+//	POST /admin/resume                        resume the GVK
+//	POST /admin/parked/release?key=           release a parked key
+//
+// The key is required by /admin/backoff/clear and /admin/parked/release. Pausing a GVK pauses it in every router
+// with the same backend as the named router, see Router.Pause.
+//
+// If the token is empty, the admin endpoints are not served. The endpoints are shared by all the routers of the
+// process, so it is an error to enable them with a different token than another router.
+func (r *Router) EnableAdmin(token string) error {
+	return setAdminToken(token)
+}
+
+// adminRequest is an authenticated admin request for a router and GVK.
+type adminRequest struct {
+	router *Router
+	gvk    schema.GroupVersionKind
+	query  map[string][]string
+}
+
+func (a adminRequest) get(name string) string {
+	if v := a.query[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// key returns the key query parameter, or a bad request error if it is empty.
+func (a adminRequest) key() (string, error) {
+	key := a.get("key")
+	if key == "" {
+		return "", badRequestError("key is required")
+	}
+	return key, nil
+}
+
+// badRequestError is returned by admin handlers for invalid query parameters.
+type badRequestError string
+
+func (b badRequestError) Error() string {
+	return string(b)
+}
+
+// authorized writes an error and returns false if the admin endpoints are not enabled or the request doesn't have
+// the admin token.
+func authorized(w http.ResponseWriter, req *http.Request) bool {
+	token := getAdminToken()
+	if token == "" {
+		http.NotFound(w, req)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")), []byte(token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// adminOnly serves the handler only to requests that have the admin token, because it reveals object keys and
+// handler errors.
+func adminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if authorized(w, req) {
+			h(w, req)
+		}
+	}
+}
+
+// adminHandler authenticates the request and resolves the router and GVK before calling the handler.
+func adminHandler(f func(ctx context.Context, req adminRequest) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !authorized(w, req) {
+			return
+		}
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := req.URL.Query()
+		r, ok := getRouters()[q.Get("router")]
+		if !ok {
+			http.Error(w, "unknown router "+q.Get("router"), http.StatusNotFound)
+			return
+		}
+
+		gv, err := schema.ParseGroupVersion(q.Get("apiVersion"))
+		if err != nil || q.Get("kind") == "" {
+			http.Error(w, "apiVersion and kind are required", http.StatusBadRequest)
+			return
+		}
+
+		result, err := f(req.Context(), adminRequest{
+			router: r,
+			gvk:    gv.WithKind(q.Get("kind")),
+			query:  q,
+		})
+		var badRequest badRequestError
+		if errors.As(err, &badRequest) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
+
+func registerAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/enqueue", adminHandler(func(ctx context.Context, req adminRequest) (any, error) {
+		if key := req.get("key"); key != "" {
+			return map[string]int{"enqueued": 1}, req.router.Enqueue(ctx, req.gvk, key)
+		}
+		selector, err := labels.Parse(req.get("selector"))
+		if err != nil {
+			return nil, badRequestError(err.Error())
+		}
+		count, err := req.router.EnqueueSelector(ctx, req.gvk, req.get("namespace"), selector)
+		return map[string]int{"enqueued": count}, err
+	}))
+	mux.HandleFunc("/admin/backoff/clear", adminHandler(func(ctx context.Context, req adminRequest) (any, error) {
+		key, err := req.key()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{}, req.router.ClearBackoff(ctx, req.gvk, key)
+	}))
+	mux.HandleFunc("/admin/pause", adminHandler(func(ctx context.Context, req adminRequest) (any, error) {
+		return map[string]string{}, req.router.Pause(ctx, req.gvk)
+	}))
+	mux.HandleFunc("/admin/resume", adminHandler(func(ctx context.Context, req adminRequest) (any, error) {
+		return map[string]string{}, req.router.Resume(ctx, req.gvk)
+	}))
+	mux.HandleFunc("/admin/parked/release", adminHandler(func(ctx context.Context, req adminRequest) (any, error) {
+		key, err := req.key()
+		if err != nil {
+			return nil, err
+		}
+		released, err := req.router.ReleaseParked(ctx, req.gvk, key)
+		return map[string]bool{"released": released}, err
+	}))
+}
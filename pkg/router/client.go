@@ -3,6 +3,7 @@ package router
 import (
 	"context"
 
+	"github.com/obot-platform/nah/pkg/apply"
 	"github.com/obot-platform/nah/pkg/backend"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/fields"
@@ -10,6 +11,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/openapi3"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -20,6 +22,7 @@ type TriggerRegistry interface {
 
 type client struct {
 	backend backend.Backend
+	orphans *orphanCollector
 	reader
 	writer
 	status
@@ -29,6 +32,23 @@ func (c *client) Watch(ctx context.Context, list kclient.ObjectList, opts ...kcl
 	return c.backend.Watch(ctx, list, opts...)
 }
 
+// OpenAPIV3Root forwards the schemas of the backend so that apply.New computes patches of custom resources
+// against the cluster the router talks to.
+func (c *client) OpenAPIV3Root() openapi3.Root {
+	if p, ok := c.backend.(apply.OpenAPIV3RootProvider); ok {
+		return p.OpenAPIV3Root()
+	}
+	return nil
+}
+
+// RecordAppliedGVK watches the GVKs that objects with an owner are applied to with apply.New and this client, if
+// the router collects orphans.
+func (c *client) RecordAppliedGVK(gvk schema.GroupVersionKind) {
+	if c.orphans != nil {
+		c.orphans.recordApplied(gvk)
+	}
+}
+
 func (c *client) Scheme() *runtime.Scheme {
 	return c.reader.client.Scheme()
 }
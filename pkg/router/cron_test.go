@@ -0,0 +1,230 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"foo * * * *",
+		"@every 1h",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := parseCron(expr)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseCronSunday(t *testing.T) {
+	for _, expr := range []string{"0 0 * * 0", "0 0 * * 7", "0 0 * * sun", "0 0 * * SUN"} {
+		t.Run(expr, func(t *testing.T) {
+			s, err := parseCron(expr)
+			require.NoError(t, err)
+			assert.Equal(t, uint64(1), s.dow&1)
+			assert.Zero(t, s.dow&0b1111110)
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		// want is the expected time in RFC 3339, or empty if the schedule never matches
+		want string
+	}{
+		{
+			name: "every 15 minutes",
+			expr: "*/15 * * * *",
+			from: time.Date(2024, 1, 1, 10, 7, 0, 0, time.UTC),
+			want: "2024-01-01T10:15:00Z",
+		},
+		{
+			name: "the time itself is not matched",
+			expr: "0 10 * * *",
+			from: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+			want: "2024-01-02T10:00:00Z",
+		},
+		{
+			name: "seconds are ignored",
+			expr: "0 10 * * *",
+			from: time.Date(2024, 1, 1, 9, 59, 59, 0, time.UTC),
+			want: "2024-01-01T10:00:00Z",
+		},
+		{
+			name: "day of month or day of week",
+			expr: "0 0 1,15 * mon",
+			// Monday the 1st
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: "2024-01-08T00:00:00Z",
+		},
+		{
+			name: "day of month or day of week matches the day of month",
+			expr: "0 0 3 * sat",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: "2024-01-03T00:00:00Z",
+		},
+		{
+			name: "day of month step starting with * and day of week",
+			expr: "0 0 */2 * mon",
+			// Mondays on an odd day of the month, the 8th is even
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: "2024-01-15T00:00:00Z",
+		},
+		{
+			name: "day of month and day of week step starting with *",
+			expr: "0 0 15 * */2",
+			// The 15th on Sunday, Tuesday, Thursday or Saturday, Monday the 15th doesn't match
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: "2024-02-15T00:00:00Z",
+		},
+		{
+			name: "7 is Sunday",
+			expr: "0 0 * * 7",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: "2024-01-07T00:00:00Z",
+		},
+		{
+			name: "range ending with Sunday",
+			expr: "0 0 * * 5-7",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: "2024-01-05T00:00:00Z",
+		},
+		{
+			name: "weekday names",
+			expr: "0 0 * * MON-FRI",
+			// Saturday
+			from: time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC),
+			want: "2024-01-08T00:00:00Z",
+		},
+		{
+			name: "month and weekday names",
+			expr: "0 12 * feb sun",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: "2024-02-04T12:00:00Z",
+		},
+		{
+			name: "month range",
+			expr: "0 0 1 jun-aug *",
+			from: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC),
+			want: "2025-06-01T00:00:00Z",
+		},
+		{
+			name: "@hourly",
+			expr: "@hourly",
+			from: time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC),
+			want: "2024-01-01T11:00:00Z",
+		},
+		{
+			name: "@daily",
+			expr: "@daily",
+			from: time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC),
+			want: "2024-01-02T00:00:00Z",
+		},
+		{
+			name: "@weekly",
+			expr: "@weekly",
+			// Wednesday
+			from: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+			want: "2024-01-07T00:00:00Z",
+		},
+		{
+			name: "@monthly",
+			expr: "@monthly",
+			from: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+			want: "2024-02-01T00:00:00Z",
+		},
+		{
+			name: "@yearly",
+			expr: "@yearly",
+			from: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+			want: "2025-01-01T00:00:00Z",
+		},
+		{
+			name: "31st skips short months",
+			expr: "5 4 31 * *",
+			from: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+			want: "2024-05-31T04:05:00Z",
+		},
+		{
+			name: "29th of February",
+			expr: "0 0 29 2 *",
+			from: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			want: "2028-02-29T00:00:00Z",
+		},
+		{
+			name: "30th of February",
+			expr: "0 0 30 2 *",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: "",
+		},
+		{
+			name: "skipped time when the clock is set forward",
+			expr: "30 2 * * *",
+			from: time.Date(2024, 3, 9, 3, 0, 0, 0, newYork),
+			want: "2024-03-11T02:30:00-04:00",
+		},
+		{
+			name: "hourly when the clock is set forward",
+			expr: "0 * * * *",
+			from: time.Date(2024, 3, 10, 1, 30, 0, 0, newYork),
+			want: "2024-03-10T03:00:00-04:00",
+		},
+		{
+			name: "repeated time when the clock is set back",
+			expr: "30 1 * * *",
+			from: time.Date(2024, 11, 3, 1, 30, 0, 0, newYork),
+			want: "2024-11-04T01:30:00-05:00",
+		},
+		{
+			name: "repeated time before it when the clock is set back",
+			expr: "30 1 * * *",
+			from: time.Date(2024, 11, 3, 0, 0, 0, 0, newYork),
+			want: "2024-11-03T01:30:00-04:00",
+		},
+		{
+			name: "hourly when the clock is set back",
+			expr: "30 * * * *",
+			from: time.Date(2024, 11, 3, 1, 30, 0, 0, newYork),
+			want: "2024-11-03T01:30:00-05:00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCron(tt.expr)
+			require.NoError(t, err)
+
+			got := s.next(tt.from)
+			if tt.want == "" {
+				assert.True(t, got.IsZero(), "expected no match but got %v", got)
+				return
+			}
+			assert.Equal(t, tt.want, got.Format(time.RFC3339))
+		})
+	}
+}
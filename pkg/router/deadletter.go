@@ -0,0 +1,38 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/obot-platform/nah/pkg/backend"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ParkedKeys returns the keys that are not retried because they failed more than the maximum attempts of their GVK.
+// It returns nil if the backend doesn't park keys.
+func (r *Router) ParkedKeys() []backend.ParkedKey {
+	if deadLetters, ok := r.handlers.backend.(backend.DeadLetters); ok {
+		return deadLetters.ParkedKeys()
+	}
+	return nil
+}
+
+// ReleaseParked enqueues a parked key of the GVK again. The key is the namespace/name of the object. It returns
+// false if the key was not parked.
+func (r *Router) ReleaseParked(ctx context.Context, gvk schema.GroupVersionKind, key string) (bool, error) {
+	if deadLetters, ok := r.handlers.backend.(backend.DeadLetters); ok {
+		return deadLetters.ReleaseParked(ctx, gvk, key)
+	}
+	return false, nil
+}
+
+// serveParked lists the parked keys of every router as JSON, by handler set name.
+func serveParked(w http.ResponseWriter, _ *http.Request) {
+	result := map[string][]backend.ParkedKey{}
+	for name, r := range getRouters() {
+		result[name] = r.ParkedKeys()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
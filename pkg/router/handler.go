@@ -2,6 +2,7 @@ package router
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -17,6 +18,7 @@ import (
 	"golang.org/x/exp/maps"
 	"golang.org/x/time/rate"
 	apierror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -25,12 +27,19 @@ import (
 )
 
 const (
-	TriggerPrefix = "_t "
-	ReplayPrefix  = "_r "
+	TriggerPrefix   = "_t "
+	ReplayPrefix    = "_r "
+	ScheduledPrefix = "_s "
 )
 
 var tracer = otel.Tracer("nah/router")
 
+// KeyPrefixes returns the prefixes that the keys of an object are enqueued with: none for changes of the object,
+// and TriggerPrefix for triggers, optionally followed by ReplayPrefix or ScheduledPrefix.
+func KeyPrefixes() []string {
+	return []string{"", TriggerPrefix, TriggerPrefix + ReplayPrefix, TriggerPrefix + ScheduledPrefix}
+}
+
 type HandlerSet struct {
 	ctx      context.Context
 	name     string
@@ -40,14 +49,27 @@ type HandlerSet struct {
 	triggers triggers
 	save     save
 	onError  ErrorHandler
+	orphans  *orphanCollector
 
 	watchingLock sync.Mutex
 	watching     map[schema.GroupVersionKind]bool
+	pending      map[schema.GroupVersionKind]bool
+	// refs are the triggers and other references, other than routes, that need each GVK to be watched
+	refs         map[schema.GroupVersionKind]map[string]bool
+	watchingCRDs bool
 	locker       locker.Locker
 
 	limiterLock sync.Mutex
 	limiters    map[limiterKey]*rate.Limiter
 	waiting     map[limiterKey]struct{}
+
+	scheduleLock     sync.Mutex
+	schedules        []*schedule
+	scheduleErrors   []error
+	schedulesStarted bool
+
+	pausedLock    sync.Mutex
+	pausedObjects map[limiterKey]PausedObject
 }
 
 type limiterKey struct {
@@ -74,6 +96,9 @@ func NewHandlerSet(name string, scheme *runtime.Scheme, backend backend.Backend)
 			client: backend,
 		},
 		watching: map[schema.GroupVersionKind]bool{},
+		refs:     map[schema.GroupVersionKind]map[string]bool{},
+
+		pausedObjects: map[limiterKey]PausedObject{},
 	}
 	hs.triggers.watcher = hs
 	return hs
@@ -83,10 +108,18 @@ func (m *HandlerSet) Start(ctx context.Context) error {
 	if m.ctx == nil {
 		m.ctx = ctx
 	}
+	if err := errors.Join(m.scheduleErrors...); err != nil {
+		return err
+	}
 	if err := m.WatchGVK(m.handlers.GVKs()...); err != nil {
 		return err
 	}
-	return m.backend.Start(ctx)
+	context.AfterFunc(ctx, m.triggers.stop)
+	if err := m.backend.Start(ctx); err != nil {
+		return err
+	}
+	m.startSchedules(ctx)
+	return nil
 }
 
 func (m *HandlerSet) Preload(ctx context.Context) error {
@@ -129,7 +162,7 @@ func (t *triggerRegistry) Watch(obj runtime.Object, namespace, name string, sel
 	return nil
 }
 
-func (m *HandlerSet) newRequestResponse(ctx context.Context, gvk schema.GroupVersionKind, key string, runtimeObject runtime.Object, trigger bool) (Request, *response, error) {
+func (m *HandlerSet) newRequestResponse(ctx context.Context, gvk schema.GroupVersionKind, key string, runtimeObject runtime.Object, cause Cause) (Request, *response, error) {
 	var (
 		obj = toObject(runtimeObject)
 	)
@@ -152,9 +185,11 @@ func (m *HandlerSet) newRequestResponse(ctx context.Context, gvk schema.GroupVer
 	}
 
 	req := Request{
-		FromTrigger: trigger,
+		FromTrigger: cause == CauseTrigger,
+		Cause:       cause,
 		Client: &client{
 			backend: m.backend,
+			orphans: m.orphans,
 			reader: reader{
 				scheme:   m.scheme,
 				client:   m.backend,
@@ -192,7 +227,7 @@ func (m *HandlerSet) WatchGVK(gvks ...schema.GroupVersionKind) error {
 	var watchErrs []error
 	m.watchingLock.Lock()
 	for _, gvk := range gvks {
-		if m.watching[gvk] {
+		if m.watching[gvk] || m.isPending(gvk) {
 			continue
 		}
 		if err := m.backend.Watcher(m.ctx, gvk, m.name, m.onChange); err == nil {
@@ -205,6 +240,13 @@ func (m *HandlerSet) WatchGVK(gvks ...schema.GroupVersionKind) error {
 	return merr.NewErrors(watchErrs...)
 }
 
+// watchingGVKs returns the GVKs whose changes the handler set is handling.
+func (m *HandlerSet) watchingGVKs() []schema.GroupVersionKind {
+	m.watchingLock.Lock()
+	defer m.watchingLock.Unlock()
+	return maps.Keys(m.watching)
+}
+
 func (m *HandlerSet) checkDelay(gvk schema.GroupVersionKind, key string) bool {
 	m.limiterLock.Lock()
 	defer m.limiterLock.Unlock()
@@ -234,11 +276,22 @@ func (m *HandlerSet) checkDelay(gvk schema.GroupVersionKind, key string) bool {
 		m.waiting[lKey] = struct{}{}
 		go func() {
 			log.Debugf("Backing off [%s] [%s] for %s", key, gvk, delay)
-			time.Sleep(delay)
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+
+			var stopped bool
+			select {
+			case <-m.ctx.Done():
+				stopped = true
+			case <-timer.C:
+			}
+
 			m.limiterLock.Lock()
 			defer m.limiterLock.Unlock()
 			delete(m.waiting, lKey)
-			_ = m.backend.Trigger(m.ctx, gvk, ReplayPrefix+key, 0)
+			if !stopped {
+				_ = m.backend.Trigger(m.ctx, gvk, ReplayPrefix+key, 0)
+			}
 		}()
 		return false
 	}
@@ -256,26 +309,28 @@ func (m *HandlerSet) onChange(ctx context.Context, gvk schema.GroupVersionKind,
 	ctx, span := tracer.Start(ctx, "onChange", trace.WithAttributes(attribute.String("key", key)), trace.WithAttributes(attribute.String("gvk", gvk.String())))
 	defer span.End()
 
-	fromTrigger := false
-	fromReplay := false
+	cause := CauseChange
 	if strings.HasPrefix(key, TriggerPrefix) {
-		fromTrigger = true
+		cause = CauseTrigger
 		key = strings.TrimPrefix(key, TriggerPrefix)
 	}
+	if strings.HasPrefix(key, ScheduledPrefix) {
+		cause = CauseScheduled
+		key = strings.TrimPrefix(key, ScheduledPrefix)
+	}
 	if strings.HasPrefix(key, ReplayPrefix) {
-		fromTrigger = false
-		fromReplay = true
+		cause = CauseReplay
 		key = strings.TrimPrefix(key, ReplayPrefix)
 	}
 
-	if !fromReplay && !fromTrigger {
+	if cause == CauseChange {
 		// Process delay have key has been reassigned from the TriggerPrefix
 		if !m.checkDelay(gvk, key) {
 			return runtimeObject, nil
 		}
 	}
 
-	obj, err := m.scheme.New(gvk)
+	obj, err := m.newObject(gvk)
 	if err != nil {
 		return nil, err
 	}
@@ -297,11 +352,30 @@ func (m *HandlerSet) onChange(ctx context.Context, gvk schema.GroupVersionKind,
 		return nil, err
 	}
 
+	if m.isObjectPaused(gvk, key, runtimeObject) {
+		return runtimeObject, nil
+	}
+
 	if runtimeObject == nil {
 		m.forgetBackoff(gvk, key)
 	}
 
-	return m.handle(ctx, gvk, key, runtimeObject, fromTrigger)
+	return m.handle(ctx, gvk, key, runtimeObject, cause)
+}
+
+// isMetadataOnly returns true if the backend only watches the metadata of the GVK.
+func (m *HandlerSet) isMetadataOnly(gvk schema.GroupVersionKind) bool {
+	metadataOnly, ok := m.backend.(backend.MetadataOnly)
+	return ok && metadataOnly.IsMetadataOnly(gvk)
+}
+
+func (m *HandlerSet) newObject(gvk schema.GroupVersionKind) (runtime.Object, error) {
+	if m.isMetadataOnly(gvk) {
+		obj := &metav1.PartialObjectMetadata{}
+		obj.SetGroupVersionKind(gvk)
+		return obj, nil
+	}
+	return m.scheme.New(gvk)
 }
 
 func (m *HandlerSet) handleError(req Request, resp Response, err error) error {
@@ -311,16 +385,24 @@ func (m *HandlerSet) handleError(req Request, resp Response, err error) error {
 	return err
 }
 
-func (m *HandlerSet) handle(ctx context.Context, gvk schema.GroupVersionKind, key string, unmodifiedObject runtime.Object, trigger bool) (runtime.Object, error) {
-	req, resp, err := m.newRequestResponse(ctx, gvk, key, unmodifiedObject, trigger)
+func (m *HandlerSet) handle(ctx context.Context, gvk schema.GroupVersionKind, key string, unmodifiedObject runtime.Object, cause Cause) (runtime.Object, error) {
+	req, resp, err := m.newRequestResponse(ctx, gvk, key, unmodifiedObject, cause)
 	if err != nil {
 		return nil, err
 	}
 
+	if m.orphans != nil {
+		if err := m.orphans.handle(ctx, gvk, key, unmodifiedObject); err != nil {
+			if err := m.handleError(req, resp, err); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	handles := m.handlers.Handles(req)
 	if handles {
-		if req.FromTrigger {
-			log.Debugf("Handling trigger [%s/%s] [%v]", req.Namespace, req.Name, req.GVK)
+		if req.Cause == CauseTrigger || req.Cause == CauseScheduled {
+			log.Debugf("Handling %s [%s/%s] [%v]", req.Cause, req.Namespace, req.Name, req.GVK)
 		} else {
 			log.Debugf("Handling [%s/%s] [%v]", req.Namespace, req.Name, req.GVK)
 		}
@@ -336,7 +418,8 @@ func (m *HandlerSet) handle(ctx context.Context, gvk schema.GroupVersionKind, ke
 	if unmodifiedObject == nil {
 		// A nil object here means that the object was deleted, so unregister the triggers
 		m.triggers.UnregisterAndTrigger(req)
-	} else if !req.FromTrigger {
+	} else if !req.FromTrigger && req.Cause != CauseScheduled {
+		// Nothing changed for a scheduled reconcile, so the objects that depend on this one aren't triggered
 		m.triggers.Trigger(req)
 	}
 	span.End()
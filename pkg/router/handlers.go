@@ -28,6 +28,25 @@ func (h *handlers) AddHandler(name string, gvk schema.GroupVersionKind, hd Handl
 	h.handlers[gvk] = append(h.handlers[gvk], handler{name: name, h: hd})
 }
 
+// SetScheduled records that the named handlers of the GVK have a resync or schedule. Scheduled reconciles only run
+// these handlers.
+func (h *handlers) SetScheduled(name string, gvk schema.GroupVersionKind) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i := range h.handlers[gvk] {
+		if h.handlers[gvk][i].name == name {
+			h.handlers[gvk][i].scheduled = true
+		}
+	}
+}
+
+func (h *handlers) Has(gvk schema.GroupVersionKind) bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return len(h.handlers[gvk]) > 0
+}
+
 func (h *handlers) Handles(req Request) bool {
 	h.lock.RLock()
 	defer h.lock.RUnlock()
@@ -43,6 +62,9 @@ func (h *handlers) Handle(req Request, resp *response) error {
 	h.lock.RUnlock()
 
 	for _, handler := range handlers {
+		if req.Cause == CauseScheduled && !handler.scheduled {
+			continue
+		}
 		err := handler.handle(req, resp)
 		if err != nil {
 			errs = append(errs, err)
@@ -52,8 +74,9 @@ func (h *handlers) Handle(req Request, resp *response) error {
 }
 
 type handler struct {
-	name string
-	h    Handler
+	name      string
+	h         Handler
+	scheduled bool
 }
 
 func (h *handler) handle(req Request, resp *response) error {
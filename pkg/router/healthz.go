@@ -12,15 +12,20 @@ import (
 )
 
 var healthz struct {
-	healths map[string]bool
-	started bool
-	lock    *sync.RWMutex
-	port    int
+	healths    map[string]bool
+	pending    map[string][]string
+	routers    map[string]*Router
+	adminToken string
+	started    bool
+	lock       *sync.RWMutex
+	port       int
 }
 
 func init() {
 	healthz.lock = &sync.RWMutex{}
 	healthz.healths = make(map[string]bool)
+	healthz.pending = make(map[string][]string)
+	healthz.routers = make(map[string]*Router)
 }
 
 func setPort(port int) {
@@ -39,6 +44,64 @@ func setHealthy(name string, healthy bool) {
 	healthz.healths[name] = healthy
 }
 
+// setPending records the types that the named handler set is waiting on to be installed.
+func setPending(name string, gvks []string) {
+	healthz.lock.Lock()
+	defer healthz.lock.Unlock()
+	if len(gvks) == 0 {
+		delete(healthz.pending, name)
+		return
+	}
+	healthz.pending[name] = gvks
+}
+
+// GetPending returns the types, by handler set name, that are not watched yet because their
+// CustomResourceDefinitions are not established.
+func GetPending() map[string][]string {
+	healthz.lock.RLock()
+	defer healthz.lock.RUnlock()
+	result := make(map[string][]string, len(healthz.pending))
+	for name, gvks := range healthz.pending {
+		result[name] = append([]string(nil), gvks...)
+	}
+	return result
+}
+
+// setRouter records the router of the named handler set for the debug and admin endpoints.
+func setRouter(name string, r *Router) {
+	healthz.lock.Lock()
+	defer healthz.lock.Unlock()
+	healthz.routers[name] = r
+}
+
+func getRouters() map[string]*Router {
+	healthz.lock.RLock()
+	defer healthz.lock.RUnlock()
+	result := make(map[string]*Router, len(healthz.routers))
+	for name, r := range healthz.routers {
+		result[name] = r
+	}
+	return result
+}
+
+// setAdminToken sets the token of the admin endpoints, which are shared by all the routers of the process. A
+// different token than the one already set is an error.
+func setAdminToken(token string) error {
+	healthz.lock.Lock()
+	defer healthz.lock.Unlock()
+	if healthz.adminToken != "" && healthz.adminToken != token {
+		return fmt.Errorf("a different admin token is already set, all routers must use the same admin token")
+	}
+	healthz.adminToken = token
+	return nil
+}
+
+func getAdminToken() string {
+	healthz.lock.RLock()
+	defer healthz.lock.RUnlock()
+	return healthz.adminToken
+}
+
 func GetHealthy() bool {
 	healthz.lock.RLock()
 	defer healthz.lock.RUnlock()
@@ -51,7 +114,9 @@ func GetHealthy() bool {
 }
 
 // startHealthz starts a healthz server on the healthzPort. If the server is already running, then this is a no-op.
-// Similarly, if the healthzPort is <= 0, then this is a no-op.
+// Similarly, if the healthzPort is <= 0, then this is a no-op. The server also serves the admin endpoints, see
+// Router.EnableAdmin, and, to requests with the admin token, lists parked keys on /debug/parked and paused GVKs and
+// objects on /debug/paused.
 func startHealthz(ctx context.Context) {
 	healthz.lock.Lock()
 	defer healthz.lock.Unlock()
@@ -67,10 +132,28 @@ func startHealthz(ctx context.Context) {
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
 		if GetHealthy() {
 			w.WriteHeader(http.StatusOK)
-			return
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		for name, gvks := range GetPending() {
+			for _, gvk := range gvks {
+				_, _ = fmt.Fprintf(w, "[%s] pending %s\n", name, gvk)
+			}
+		}
+		// Paused GVKs and objects do not make the router unhealthy, but are reported so they are not forgotten
+		for name, status := range getPaused() {
+			for _, gvk := range status.GVKs {
+				_, _ = fmt.Fprintf(w, "[%s] paused %s\n", name, gvk)
+			}
+			// The keys are only listed on /debug/paused, which requires the admin token
+			if len(status.Objects) > 0 {
+				_, _ = fmt.Fprintf(w, "[%s] %d paused objects\n", name, len(status.Objects))
+			}
 		}
-		w.WriteHeader(http.StatusServiceUnavailable)
 	})
+	mux.HandleFunc("/debug/parked", adminOnly(serveParked))
+	mux.HandleFunc("/debug/paused", adminOnly(servePaused))
+	registerAdmin(mux)
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", healthz.port),
@@ -0,0 +1,295 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/obot-platform/nah/pkg/apply"
+	"github.com/obot-platform/nah/pkg/backend"
+	"github.com/obot-platform/nah/pkg/log"
+	"github.com/obot-platform/nah/pkg/untriggered"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/strings/slices"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// OrphanCollectorOptions configures the orphan collector started with Router.CollectOrphans.
+type OrphanCollectorOptions struct {
+	// FinalizerID, if set, is added to the owners of applied objects. When an owner is deleted, its children
+	// are deleted before the finalizer is removed.
+	FinalizerID string
+}
+
+// CollectOrphans deletes objects created by apply whose owner no longer exists. Owner references can't be set
+// on cluster scoped objects or objects in another namespace than the owner, so Kubernetes garbage collection
+// does not delete them. Every GVK that objects with an owner are applied to, with apply.New and the client of a
+// request of this router, is watched and the children are indexed by the owner annotations. The GVKs of the owners
+// are watched for their metadata only, unless they have routes. This must be called before the router is started.
+func (r *Router) CollectOrphans(opts OrphanCollectorOptions) {
+	r.handlers.orphans = &orphanCollector{
+		handlers:    r.handlers,
+		finalizerID: opts.FinalizerID,
+		children:    map[orphanKey]map[orphanKey]struct{}{},
+		owners:      map[orphanKey]orphanKey{},
+		applied:     map[schema.GroupVersionKind]bool{},
+		ownerGVKs:   map[schema.GroupVersionKind]bool{},
+	}
+}
+
+type orphanKey struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+	name      string
+}
+
+func (o orphanKey) key() string {
+	return toKey(o.namespace, o.name)
+}
+
+type orphanCollector struct {
+	handlers    *HandlerSet
+	finalizerID string
+
+	lock sync.Mutex
+	// children is the set of children indexed by the owner
+	children map[orphanKey]map[orphanKey]struct{}
+	// owners is the owner of each child
+	owners map[orphanKey]orphanKey
+	// applied are the GVKs that objects with an owner were applied to
+	applied map[schema.GroupVersionKind]bool
+	// ownerGVKs are the GVKs of the owners of children
+	ownerGVKs map[schema.GroupVersionKind]bool
+}
+
+// recordApplied watches the GVK the first time objects with an owner are applied to it.
+func (o *orphanCollector) recordApplied(gvk schema.GroupVersionKind) {
+	o.lock.Lock()
+	if o.applied[gvk] {
+		o.lock.Unlock()
+		return
+	}
+	o.applied[gvk] = true
+	o.lock.Unlock()
+
+	if err := o.handlers.watchGVKFor(refOrphans, gvk); err != nil {
+		log.Errorf("failed to watch %v for orphan collection: %v", gvk, err)
+	}
+}
+
+// collects returns if objects of the GVK may be children or owners of children.
+func (o *orphanCollector) collects(gvk schema.GroupVersionKind) (child bool, owner bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.applied[gvk], o.ownerGVKs[gvk]
+}
+
+func (o *orphanCollector) index(child, owner orphanKey) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.ownerGVKs[owner.gvk] = true
+	if old, ok := o.owners[child]; ok && old != owner {
+		o.unindexLocked(child)
+	}
+	o.owners[child] = owner
+	if o.children[owner] == nil {
+		o.children[owner] = map[orphanKey]struct{}{}
+	}
+	o.children[owner][child] = struct{}{}
+}
+
+// unindex removes the child and returns its owner, if it had one, and if that owner has no more children.
+func (o *orphanCollector) unindex(child orphanKey) (orphanKey, bool, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	owner, ok := o.owners[child]
+	if !ok {
+		return orphanKey{}, false, false
+	}
+	o.unindexLocked(child)
+	return owner, true, len(o.children[owner]) == 0
+}
+
+func (o *orphanCollector) unindexLocked(child orphanKey) {
+	owner := o.owners[child]
+	delete(o.owners, child)
+	delete(o.children[owner], child)
+	if len(o.children[owner]) == 0 {
+		delete(o.children, owner)
+	}
+}
+
+func (o *orphanCollector) childrenOf(owner orphanKey) []orphanKey {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	result := make([]orphanKey, 0, len(o.children[owner]))
+	for child := range o.children[owner] {
+		result = append(result, child)
+	}
+	return result
+}
+
+func (o *orphanCollector) handle(ctx context.Context, gvk schema.GroupVersionKind, key string, runtimeObject runtime.Object) error {
+	isChild, isOwner := o.collects(gvk)
+	if !isChild && !isOwner {
+		return nil
+	}
+
+	ns, name, ok := strings.Cut(key, "/")
+	if !ok {
+		name = key
+		ns = ""
+	}
+	self := orphanKey{gvk: gvk, namespace: ns, name: name}
+
+	if runtimeObject == nil {
+		o.removed(ctx, self)
+		return nil
+	}
+
+	obj, ok := runtimeObject.(kclient.Object)
+	if !ok {
+		return nil
+	}
+
+	if !obj.GetDeletionTimestamp().IsZero() {
+		if isOwner && o.finalizerID != "" && slices.Contains(obj.GetFinalizers(), o.finalizerID) {
+			return o.finalize(ctx, self, obj)
+		}
+		return nil
+	}
+
+	if !isChild {
+		return nil
+	}
+
+	owner := apply.OwnerOf(obj)
+	if owner.GVK.Empty() || owner.Name == "" {
+		o.ownerless(ctx, self)
+		return nil
+	}
+	o.index(self, orphanKey{gvk: owner.GVK, namespace: owner.Namespace, name: owner.Name})
+
+	// Watch the owner so that the children are checked when it is deleted. Only its metadata is needed, unless a
+	// route needs the full objects.
+	if w, ok := o.handlers.backend.(backend.MetadataOnlyWatcher); ok && !o.handlers.handlers.Has(owner.GVK) {
+		w.SetMetadataOnly(owner.GVK)
+	}
+	if err := o.handlers.watchGVKFor(refOrphans, owner.GVK); err != nil {
+		log.Debugf("Not watching owner type %v of [%s] [%v] for orphan collection: %v", owner.GVK, key, gvk, err)
+	}
+
+	ownerObj, err := o.getOwner(ctx, owner)
+	if apierror.IsNotFound(err) || meta.IsNoMatchError(err) {
+		// The cache may not have the owner yet, or may not cache its namespace, so confirm with the API server
+		if exists, err := o.ownerExists(ctx, owner); err != nil {
+			return err
+		} else if exists {
+			return nil
+		}
+		log.Infof("Deleting orphaned [%s] [%v], owner [%s] [%v] not found", key, gvk, toKey(owner.Namespace, owner.Name), owner.GVK)
+		if err := o.handlers.backend.Delete(ctx, obj); err != nil && !apierror.IsNotFound(err) {
+			return err
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if o.finalizerID != "" && ownerObj.GetDeletionTimestamp().IsZero() && !slices.Contains(ownerObj.GetFinalizers(), o.finalizerID) {
+		return o.setFinalizers(ctx, ownerObj, append(ownerObj.GetFinalizers(), o.finalizerID))
+	}
+
+	return nil
+}
+
+// getOwner reads the owner from the cache as the same type of object that its GVK is watched with.
+func (o *orphanCollector) getOwner(ctx context.Context, owner apply.Owner) (kclient.Object, error) {
+	newObj, err := o.handlers.newObject(owner.GVK)
+	if err != nil {
+		return nil, err
+	}
+	ownerObj, ok := newObj.(kclient.Object)
+	if !ok {
+		return nil, fmt.Errorf("owner type %v is not a client.Object", owner.GVK)
+	}
+	return ownerObj, o.handlers.backend.Get(ctx, kclient.ObjectKey{Namespace: owner.Namespace, Name: owner.Name}, ownerObj)
+}
+
+// ownerExists reads the owner from the API server, instead of the cache, to confirm that it is gone. An owner
+// whose type is no longer served is gone, the REST mapper discovers the group again before it reports no match.
+func (o *orphanCollector) ownerExists(ctx context.Context, owner apply.Owner) (bool, error) {
+	ownerObj := &metav1.PartialObjectMetadata{}
+	ownerObj.SetGroupVersionKind(owner.GVK)
+	err := o.handlers.backend.Get(ctx, kclient.ObjectKey{Namespace: owner.Namespace, Name: owner.Name}, untriggered.UncachedGet(ownerObj))
+	if apierror.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// setFinalizers patches the finalizers of obj, which may only have its metadata and so can't be updated.
+func (o *orphanCollector) setFinalizers(ctx context.Context, obj kclient.Object, finalizers []string) error {
+	patch := kclient.MergeFromWithOptions(obj.DeepCopyObject().(kclient.Object), kclient.MergeFromWithOptimisticLock{})
+	obj.SetFinalizers(finalizers)
+	return o.handlers.backend.Patch(ctx, obj, patch)
+}
+
+// ownerless is called when a live object has no owner. It is removed from the index, and its previous owner is
+// enqueued if it is waiting for its last child to be deleted. Its own children are left alone.
+func (o *orphanCollector) ownerless(ctx context.Context, self orphanKey) {
+	if owner, ok, last := o.unindex(self); ok && last && o.finalizerID != "" {
+		_ = o.handlers.backend.Trigger(ctx, owner.gvk, owner.key(), 0)
+	}
+}
+
+// removed is called when an object is deleted. The children of the object are enqueued so that they are
+// deleted, and the owner of the object is enqueued if it is waiting for its last child to be deleted.
+func (o *orphanCollector) removed(ctx context.Context, self orphanKey) {
+	for _, child := range o.childrenOf(self) {
+		_ = o.handlers.backend.Trigger(ctx, child.gvk, child.key(), 0)
+	}
+
+	if owner, ok, last := o.unindex(self); ok && last && o.finalizerID != "" {
+		_ = o.handlers.backend.Trigger(ctx, owner.gvk, owner.key(), 0)
+	}
+}
+
+// finalize deletes the children of the owner and removes the finalizer once they are all gone.
+func (o *orphanCollector) finalize(ctx context.Context, self orphanKey, obj kclient.Object) error {
+	children := o.childrenOf(self)
+	for _, child := range children {
+		ustr := &unstructured.Unstructured{}
+		ustr.SetGroupVersionKind(child.gvk)
+		ustr.SetNamespace(child.namespace)
+		ustr.SetName(child.name)
+		log.Infof("Deleting [%s] [%v] owned by finalizing [%s] [%v]", child.key(), child.gvk, self.key(), self.gvk)
+		if err := o.handlers.backend.Delete(ctx, ustr); apierror.IsNotFound(err) {
+			o.unindex(child)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(o.childrenOf(self)) > 0 {
+		// The owner is enqueued again when the last child is removed.
+		return nil
+	}
+
+	var finalizers []string
+	for _, f := range obj.GetFinalizers() {
+		if f != o.finalizerID {
+			finalizers = append(finalizers, f)
+		}
+	}
+	return o.setFinalizers(ctx, obj.DeepCopyObject().(kclient.Object), finalizers)
+}
@@ -0,0 +1,98 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PausedAnnotation pauses the handlers of an object while its value is "true". Changes and triggers of the object
+// are not handled while it is paused. They are handled once, with the current state of the object, when the
+// annotation is removed. Objects that are deleted while paused keep their finalizers until they are resumed.
+const PausedAnnotation = "nah.obot.ai/paused"
+
+// PausedObject is an object that is not handled because it has the PausedAnnotation.
+type PausedObject struct {
+	GVK schema.GroupVersionKind `json:"gvk"`
+	Key string                  `json:"key"`
+	// Events is the number of changes and triggers of the object held while it was paused
+	Events int       `json:"events"`
+	Since  time.Time `json:"since"`
+}
+
+// isObjectPaused returns true if the object has the PausedAnnotation and records the held event. If the object was
+// paused and is not anymore, it is forgotten so that the event is handled.
+func (m *HandlerSet) isObjectPaused(gvk schema.GroupVersionKind, key string, obj runtime.Object) bool {
+	paused := false
+	if o, ok := obj.(kclient.Object); ok {
+		paused = o.GetAnnotations()[PausedAnnotation] == "true"
+	}
+
+	pausedKey := limiterKey{key: key, gvk: gvk}
+
+	m.pausedLock.Lock()
+	defer m.pausedLock.Unlock()
+
+	if !paused {
+		delete(m.pausedObjects, pausedKey)
+		return false
+	}
+
+	p, ok := m.pausedObjects[pausedKey]
+	if !ok {
+		p = PausedObject{
+			GVK:   gvk,
+			Key:   key,
+			Since: time.Now(),
+		}
+	}
+	p.Events++
+	m.pausedObjects[pausedKey] = p
+	return true
+}
+
+// PausedObjects returns the objects that have the PausedAnnotation and have had events held, oldest first.
+func (r *Router) PausedObjects() []PausedObject {
+	m := r.handlers
+	m.pausedLock.Lock()
+	defer m.pausedLock.Unlock()
+
+	result := make([]PausedObject, 0, len(m.pausedObjects))
+	for _, p := range m.pausedObjects {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Since.Before(result[j].Since)
+	})
+	return result
+}
+
+type pausedStatus struct {
+	GVKs    []schema.GroupVersionKind `json:"gvks"`
+	Objects []PausedObject            `json:"objects"`
+}
+
+func getPaused() map[string]pausedStatus {
+	result := map[string]pausedStatus{}
+	for name, r := range getRouters() {
+		status := pausedStatus{
+			GVKs:    r.PausedGVKs(),
+			Objects: r.PausedObjects(),
+		}
+		if len(status.GVKs) > 0 || len(status.Objects) > 0 {
+			result[name] = status
+		}
+	}
+	return result
+}
+
+// servePaused lists the paused GVKs and objects of every router as JSON, by handler set name.
+func servePaused(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(getPaused())
+}
@@ -0,0 +1,168 @@
+package router
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/obot-platform/nah/pkg/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const pendingRetryInterval = 30 * time.Second
+
+var crdListGVK = schema.GroupVersionKind{
+	Group:   "apiextensions.k8s.io",
+	Version: "v1",
+	Kind:    "CustomResourceDefinitionList",
+}
+
+// isPending returns true if the GVK is not known to the API server, in which case it is watched once its
+// CustomResourceDefinition is established. watchingLock must be held.
+func (m *HandlerSet) isPending(gvk schema.GroupVersionKind) bool {
+	if _, err := m.backend.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); !meta.IsNoMatchError(err) {
+		delete(m.pending, gvk)
+		return false
+	}
+
+	if !m.pending[gvk] {
+		log.Infof("Deferring watch of [%v] until its CustomResourceDefinition is established", gvk)
+		if m.pending == nil {
+			m.pending = map[schema.GroupVersionKind]bool{}
+		}
+		m.pending[gvk] = true
+	}
+	if !m.watchingCRDs && m.ctx != nil {
+		m.watchingCRDs = true
+		go m.watchCRDs(m.ctx)
+	}
+	m.setPendingHealth()
+	return true
+}
+
+// PendingGVKs returns the GVKs that have handlers or triggers but are not watched because their
+// CustomResourceDefinitions are not established.
+func (m *HandlerSet) PendingGVKs() []schema.GroupVersionKind {
+	m.watchingLock.Lock()
+	defer m.watchingLock.Unlock()
+	return m.pendingGVKs()
+}
+
+func (m *HandlerSet) pendingGVKs() []schema.GroupVersionKind {
+	result := make([]schema.GroupVersionKind, 0, len(m.pending))
+	for gvk := range m.pending {
+		result = append(result, gvk)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+	return result
+}
+
+func (m *HandlerSet) setPendingHealth() {
+	var pending []string
+	for _, gvk := range m.pendingGVKs() {
+		pending = append(pending, gvk.String())
+	}
+	setPending(m.name, pending)
+}
+
+// retryPending watches the pending GVKs, of the group and kind if set, and returns true if any are still pending.
+func (m *HandlerSet) retryPending(gk schema.GroupKind) bool {
+	var gvks []schema.GroupVersionKind
+	for _, gvk := range m.PendingGVKs() {
+		if gk.Empty() || gvk.GroupKind() == gk {
+			gvks = append(gvks, gvk)
+		}
+	}
+	if len(gvks) > 0 {
+		if err := m.WatchGVK(gvks...); err != nil {
+			log.Errorf("failed to watch %v: %v", gvks, err)
+		}
+	}
+
+	m.watchingLock.Lock()
+	defer m.watchingLock.Unlock()
+	m.setPendingHealth()
+	if len(m.pending) == 0 {
+		m.watchingCRDs = false
+		return false
+	}
+	return true
+}
+
+// watchCRDs watches CustomResourceDefinitions until there are no pending GVKs.
+func (m *HandlerSet) watchCRDs(ctx context.Context) {
+	for {
+		if err := m.watchCRDsOnce(ctx); err != nil {
+			log.Warnf("failed to watch CustomResourceDefinitions for pending types: %v", err)
+		}
+		if !m.retryPending(schema.GroupKind{}) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			m.watchingLock.Lock()
+			m.watchingCRDs = false
+			m.watchingLock.Unlock()
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (m *HandlerSet) watchCRDsOnce(ctx context.Context) error {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(crdListGVK)
+
+	w, err := m.backend.Watch(ctx, list)
+	if err != nil {
+		return err
+	}
+	defer w.Stop()
+
+	ticker := time.NewTicker(pendingRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			// Discovery may lag behind the CRD becoming established
+			if !m.retryPending(schema.GroupKind{}) {
+				return nil
+			}
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			if event.Type != watch.Added && event.Type != watch.Modified {
+				continue
+			}
+			crd, ok := event.Object.(*unstructured.Unstructured)
+			if !ok || !crdEstablished(crd) {
+				continue
+			}
+			group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+			kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+			if !m.retryPending(schema.GroupKind{Group: group, Kind: kind}) {
+				return nil
+			}
+		}
+	}
+}
+
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, cond := range conditions {
+		m, _ := cond.(map[string]any)
+		if m["type"] == "Established" && m["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
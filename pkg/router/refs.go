@@ -0,0 +1,50 @@
+package router
+
+import (
+	"github.com/obot-platform/nah/pkg/backend"
+	"github.com/obot-platform/nah/pkg/log"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const refOrphans = "orphans"
+
+// watchGVKFor records that ref, such as a trigger, needs the GVKs to be watched and watches them.
+func (m *HandlerSet) watchGVKFor(ref string, gvks ...schema.GroupVersionKind) error {
+	m.watchingLock.Lock()
+	for _, gvk := range gvks {
+		if m.refs[gvk] == nil {
+			m.refs[gvk] = map[string]bool{}
+		}
+		m.refs[gvk][ref] = true
+	}
+	m.watchingLock.Unlock()
+	return m.WatchGVK(gvks...)
+}
+
+// releaseGVK removes the reference to the GVK. The GVK is no longer watched, and its informer is removed, when it
+// has no references and no routes, if the backend can stop watching it.
+func (m *HandlerSet) releaseGVK(ref string, gvk schema.GroupVersionKind) {
+	m.watchingLock.Lock()
+	defer m.watchingLock.Unlock()
+
+	delete(m.refs[gvk], ref)
+	if len(m.refs[gvk]) > 0 || m.handlers.Has(gvk) {
+		return
+	}
+	delete(m.refs, gvk)
+	if m.pending[gvk] {
+		delete(m.pending, gvk)
+		m.setPendingHealth()
+	}
+
+	remover, ok := m.backend.(backend.WatcherRemover)
+	if !ok || !m.watching[gvk] {
+		return
+	}
+	delete(m.watching, gvk)
+
+	log.Debugf("Stopping watch of [%v], no routes or triggers need it", gvk)
+	if err := remover.RemoveWatcher(m.ctx, gvk, m.name); err != nil {
+		log.Warnf("failed to stop watching %v: %v", gvk, err)
+	}
+}
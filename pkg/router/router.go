@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/obot-platform/nah/pkg/backend"
 	"github.com/obot-platform/nah/pkg/leader"
@@ -16,15 +17,35 @@ import (
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// DefaultDrainTimeout is how long a router waits for the keys being handled when it stops.
+const DefaultDrainTimeout = 30 * time.Second
+
 type Router struct {
 	RouteBuilder
 
 	OnErrorHandler ErrorHandler
+	// DrainTimeout is how long to wait for the keys being handled when the router stops. Defaults to
+	// DefaultDrainTimeout, a negative value waits until they are done. The timeout only bounds when Stopped is
+	// closed: handlers that ignore the cancellation of their context keep running, and their workers and
+	// controllers stop only after they return.
+	DrainTimeout   time.Duration
 	handlers       *HandlerSet
 	electionConfig *leader.ElectionConfig
 	startLock      sync.Mutex
 	postStarts     []func(context.Context, kclient.Client)
 	signalStopped  chan struct{}
+	stopOnce       sync.Once
+	draining       bool
+	stopStatus     StopStatus
+}
+
+// StopStatus is how a router stopped, see Router.StopStatus.
+type StopStatus struct {
+	// Drained is false if keys were still being handled when the drain timeout passed
+	Drained  bool          `json:"drained"`
+	Duration time.Duration `json:"duration"`
+	// GVKs are the GVKs that were not drained or had pending keys that were not handled
+	GVKs []backend.DrainStatus `json:"gvks,omitempty"`
 }
 
 // New returns a new *Router with given HandlerSet and ElectionConfig. Passing a nil ElectionConfig is valid and results
@@ -47,6 +68,8 @@ func New(handlerSet *HandlerSet, electionConfig *leader.ElectionConfig, healthzP
 	return r
 }
 
+// Stopped returns a channel that is closed when the router has stopped, after its handlers are drained or the
+// DrainTimeout passed. Handlers that were still running at the timeout may not have returned yet.
 func (r *Router) Stopped() <-chan struct{} {
 	// Hold the start lock to ensure we aren't starting and stopping at the same time.
 	r.startLock.Lock()
@@ -60,6 +83,13 @@ func (r *Router) Stopped() <-chan struct{} {
 	return r.signalStopped
 }
 
+// StopStatus returns how the router stopped. It is set when the channel returned by Stopped is closed.
+func (r *Router) StopStatus() StopStatus {
+	r.startLock.Lock()
+	defer r.startLock.Unlock()
+	return r.stopStatus
+}
+
 func (r *Router) Backend() backend.Backend {
 	return r.handlers.backend
 }
@@ -85,6 +115,9 @@ type RouteBuilder struct {
 	middleware        []Middleware
 	sel               labels.Selector
 	fieldSelector     fields.Selector
+	resyncEvery       time.Duration
+	schedule          string
+	jitter            *time.Duration
 }
 
 func (r RouteBuilder) Middleware(m ...Middleware) RouteBuilder {
@@ -201,6 +234,7 @@ func (r RouteBuilder) Handler(h Handler) {
 	}
 
 	r.router.handlers.AddHandler(r.routeName, r.objType, result)
+	r.addSchedule()
 }
 
 func (r *Router) Start(ctx context.Context) error {
@@ -209,6 +243,7 @@ func (r *Router) Start(ctx context.Context) error {
 		return err
 	}
 
+	setRouter(r.handlers.name, r)
 	startHealthz(ctx)
 
 	r.handlers.onError = r.OnErrorHandler
@@ -238,9 +273,73 @@ func (r *Router) done() {
 	r.startLock.Lock()
 	defer r.startLock.Unlock()
 
-	if r.signalStopped != nil {
-		close(r.signalStopped)
+	if r.draining {
+		// The handlers were started, drain signals when they are stopped
+		return
+	}
+	r.signalStoppedLocked()
+}
+
+func (r *Router) signalStoppedLocked() {
+	r.stopOnce.Do(func() {
+		if r.signalStopped != nil {
+			close(r.signalStopped)
+		}
+	})
+}
+
+// drain waits for the handlers to stop when ctx is done, up to the DrainTimeout, logs the keys that were not
+// handled, and signals that the router is stopped. If the backend can't drain, the router is stopped without
+// waiting and reported as drained.
+func (r *Router) drain(ctx context.Context) {
+	<-ctx.Done()
+
+	drainer, ok := r.handlers.backend.(backend.Drainer)
+	if !ok {
+		log.Infof("Stopped handlers of [%s], the backend does not drain them", r.handlers.name)
+		r.startLock.Lock()
+		defer r.startLock.Unlock()
+		r.stopStatus = StopStatus{Drained: true}
+		r.signalStoppedLocked()
+		return
+	}
+
+	timeout := r.DrainTimeout
+	if timeout == 0 {
+		timeout = DefaultDrainTimeout
+	}
+	drainCtx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithTimeout(drainCtx, timeout)
+		defer cancel()
+	}
+
+	log.Infof("Draining handlers of [%s]", r.handlers.name)
+	start := time.Now()
+	status := StopStatus{
+		Drained: true,
 	}
+	// Only the controllers of this router are drained, other routers sharing the backend may still be running
+	for _, gvkStatus := range drainer.Drain(drainCtx, r.handlers.watchingGVKs()...) {
+		if !gvkStatus.Drained {
+			status.Drained = false
+			log.Errorf("Stopped handling [%v] after %s with keys still in flight: %v", gvkStatus.GVK, timeout, gvkStatus.InFlight)
+		}
+		if len(gvkStatus.Pending) > 0 {
+			log.Infof("Stopped handling [%v] with %d pending keys: %v", gvkStatus.GVK, len(gvkStatus.Pending), gvkStatus.Pending)
+		}
+		if !gvkStatus.Drained || len(gvkStatus.Pending) > 0 {
+			status.GVKs = append(status.GVKs, gvkStatus)
+		}
+	}
+	status.Duration = time.Since(start)
+	log.Infof("Stopped handlers of [%s] in %s, drained: %v", r.handlers.name, status.Duration, status.Drained)
+
+	r.startLock.Lock()
+	defer r.startLock.Unlock()
+	r.stopStatus = status
+	r.signalStoppedLocked()
 }
 
 // startHandlers gets called when we become the leader or if there is no leader election.
@@ -261,6 +360,11 @@ func (r *Router) startHandlers(ctx context.Context) error {
 		return err
 	}
 
+	if !r.draining {
+		r.draining = true
+		go r.drain(ctx)
+	}
+
 	for _, f := range r.postStarts {
 		f(ctx, r.Backend())
 	}
@@ -0,0 +1,192 @@
+package router
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/obot-platform/nah/pkg/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ResyncEvery reconciles every object of the route's type, in the route's namespace and matching its selector, once
+// per period. Each object is enqueued after a random delay of up to the jitter, which defaults to a tenth of the period.
+// Like Schedule, the resync only runs the routes of the type that have a resync or schedule.
+func (r RouteBuilder) ResyncEvery(period time.Duration) RouteBuilder {
+	r.resyncEvery = period
+	return r
+}
+
+// Schedule reconciles every object of the route's type, in the route's namespace and matching its selector, at the
+// times matched by the standard five field cron expression, or one of @yearly, @annually, @monthly, @weekly, @daily,
+// @midnight, and @hourly. Each object is enqueued after a random delay of up to the jitter, which defaults to one
+// minute. An invalid expression is returned as an error when the router is started.
+//
+// The day of month and day of week fields match either day, unless one of them starts with *, as in cron. Times
+// that are skipped by a daylight saving time change are not matched on that day, and times that occur twice are
+// matched once, unless the hour field matches every hour.
+//
+// Scheduled reconciles only run the routes of the type that have a resync or schedule, and are queued behind the
+// changes and triggers of the type, like retries.
+func (r RouteBuilder) Schedule(cronExpr string) RouteBuilder {
+	r.schedule = cronExpr
+	return r
+}
+
+// Jitter sets the maximum random delay before each object is enqueued by ResyncEvery or Schedule, so that all the
+// objects are not reconciled at once.
+func (r RouteBuilder) Jitter(jitter time.Duration) RouteBuilder {
+	r.jitter = &jitter
+	return r
+}
+
+// addSchedule records the resync or schedule of the route, if it has one.
+func (r RouteBuilder) addSchedule() {
+	if r.resyncEvery <= 0 && r.schedule == "" {
+		return
+	}
+
+	s := &schedule{
+		route:     r.routeName,
+		objType:   r.objType,
+		name:      r.name,
+		namespace: r.namespace,
+		selector:  r.sel,
+		every:     r.resyncEvery,
+	}
+
+	if r.schedule != "" {
+		cron, err := parseCron(r.schedule)
+		if err != nil {
+			r.router.handlers.scheduleErrors = append(r.router.handlers.scheduleErrors, err)
+			return
+		}
+		s.cron = cron
+		s.jitter = time.Minute
+	} else {
+		s.jitter = r.resyncEvery / 10
+	}
+	if r.jitter != nil {
+		s.jitter = *r.jitter
+	}
+
+	gvk, err := r.router.handlers.backend.GVKForObject(r.objType, r.router.handlers.scheme)
+	if err != nil {
+		r.router.handlers.scheduleErrors = append(r.router.handlers.scheduleErrors, err)
+		return
+	}
+	r.router.handlers.handlers.SetScheduled(r.routeName, gvk)
+	r.router.handlers.schedules = append(r.router.handlers.schedules, s)
+}
+
+type schedule struct {
+	route     string
+	objType   kclient.Object
+	name      string
+	namespace string
+	selector  labels.Selector
+	every     time.Duration
+	cron      *cronSchedule
+	jitter    time.Duration
+}
+
+func (s *schedule) next(now time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.next(now)
+	}
+	return now.Add(s.every)
+}
+
+// startSchedules starts the resyncs and schedules of the routes, once.
+func (m *HandlerSet) startSchedules(ctx context.Context) {
+	m.scheduleLock.Lock()
+	defer m.scheduleLock.Unlock()
+	if m.schedulesStarted {
+		return
+	}
+	m.schedulesStarted = true
+	for _, s := range m.schedules {
+		go m.runSchedule(ctx, s)
+	}
+}
+
+func (m *HandlerSet) runSchedule(ctx context.Context, s *schedule) {
+	for {
+		next := s.next(time.Now())
+		if next.IsZero() {
+			log.Errorf("Schedule of route [%s] never matches, not reconciling on a schedule", s.route)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		if err := m.enqueueScheduled(ctx, s); err != nil {
+			log.Errorf("Failed to enqueue scheduled reconcile of route [%s]: %v", s.route, err)
+		}
+	}
+}
+
+// enqueueScheduled triggers every object of the schedule through the backend, each after a random delay of up to
+// the jitter.
+func (m *HandlerSet) enqueueScheduled(ctx context.Context, s *schedule) error {
+	gvk, err := m.backend.GVKForObject(s.objType, m.scheme)
+	if err != nil {
+		return err
+	}
+
+	list, err := m.newObjectList(gvk)
+	if err != nil {
+		return err
+	}
+
+	if err := m.backend.List(ctx, list, &kclient.ListOptions{
+		Namespace:     s.namespace,
+		LabelSelector: s.selector,
+	}); err != nil {
+		return err
+	}
+
+	return meta.EachListItem(list, func(item runtime.Object) error {
+		obj, ok := item.(kclient.Object)
+		if !ok || s.name != "" && obj.GetName() != s.name {
+			return nil
+		}
+		var delay time.Duration
+		if s.jitter > 0 {
+			delay = rand.N(s.jitter)
+		}
+		return m.backend.Trigger(ctx, gvk, ScheduledPrefix+toKey(obj.GetNamespace(), obj.GetName()), delay)
+	})
+}
+
+func (m *HandlerSet) newObjectList(gvk schema.GroupVersionKind) (kclient.ObjectList, error) {
+	listGVK := gvk
+	listGVK.Kind = strings.TrimSuffix(gvk.Kind, "List") + "List"
+
+	if m.isMetadataOnly(gvk) {
+		list := &metav1.PartialObjectMetadataList{}
+		list.SetGroupVersionKind(listGVK)
+		return list, nil
+	}
+
+	obj, err := m.scheme.New(listGVK)
+	if runtime.IsNotRegisteredError(err) {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(listGVK)
+		return list, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return obj.(kclient.ObjectList), nil
+}
@@ -180,6 +180,7 @@ func NewRequestWithContext(t *testing.T, ctx context.Context, scheme *runtime.Sc
 		Name:        input.GetName(),
 		Key:         toKey(input.GetNamespace(), input.GetName()),
 		FromTrigger: false,
+		Cause:       router.CauseChange,
 	}
 }
 
@@ -25,6 +25,7 @@ type triggers struct {
 	toTrigger      map[triggerKey]kclient.Object
 	triggerLock    *sync.Cond
 	triggerRunning bool
+	triggerStopped bool
 	trigger        backend.Trigger
 	gvkLookup      backend.Backend
 	scheme         *runtime.Scheme
@@ -32,7 +33,8 @@ type triggers struct {
 }
 
 type watcher interface {
-	WatchGVK(gvks ...schema.GroupVersionKind) error
+	watchGVKFor(ref string, gvks ...schema.GroupVersionKind) error
+	releaseGVK(ref string, gvk schema.GroupVersionKind)
 }
 
 type triggerKey struct {
@@ -46,8 +48,12 @@ type enqueueTarget struct {
 	gvk schema.GroupVersionKind
 }
 
+func (et enqueueTarget) String() string {
+	return et.gvk.String() + ": " + et.key
+}
+
 func (et enqueueTarget) MarshalText() ([]byte, error) {
-	return []byte(et.gvk.String() + ": " + et.key), nil
+	return []byte(et.String()), nil
 }
 
 func (m *triggers) register(gvk schema.GroupVersionKind, key string, targetGVK schema.GroupVersionKind, mr objectMatcher) {
@@ -92,10 +98,13 @@ func (m *triggers) Register(sourceGVK schema.GroupVersionKind, key string, obj r
 		Fields:    fields,
 	})
 
-	return gvk, true, m.watcher.WatchGVK(gvk)
+	return gvk, true, m.watcher.watchGVKFor(enqueueTarget{key: key, gvk: sourceGVK}.String(), gvk)
 }
 
 func (m *triggers) kick() {
+	if m.triggerStopped {
+		return
+	}
 	if m.triggerRunning {
 		m.triggerLock.Broadcast()
 		return
@@ -105,6 +114,10 @@ func (m *triggers) kick() {
 		m.triggerLock.L.Lock()
 		defer m.triggerLock.L.Unlock()
 		for {
+			if m.triggerStopped {
+				m.triggerRunning = false
+				return
+			}
 			if len(m.toTrigger) == 0 {
 				m.triggerLock.Wait()
 				continue
@@ -131,6 +144,15 @@ func (m *triggers) kick() {
 	}()
 }
 
+// stop stops the trigger loop after the triggers it is processing. Triggers after it is stopped are dropped.
+func (m *triggers) stop() {
+	m.triggerLock.L.Lock()
+	defer m.triggerLock.L.Unlock()
+	m.triggerStopped = true
+	m.toTrigger = nil
+	m.triggerLock.Broadcast()
+}
+
 // UnregisterAndTrigger will unregister all triggers for the object, both as source and target.
 // If a trigger source matches the object exactly, then the trigger will be invoked.
 func (m *triggers) UnregisterAndTrigger(req Request) {
@@ -184,10 +206,14 @@ func (m *triggers) process(ctx context.Context, pending map[triggerKey]kclient.O
 
 		for key, obj := range pending {
 			if obj == nil {
-				matchers.Delete(enqueueTarget{
+				target := enqueueTarget{
 					key: toKey(key.namespace, key.name),
 					gvk: key.gvk,
-				})
+				}
+				if _, loaded := matchers.LoadAndDelete(target); loaded {
+					// The deleted object no longer needs the target type watched
+					m.watcher.releaseGVK(target.String(), targetGVK.GroupVersionKind)
+				}
 				if key.gvk == targetGVK.GroupVersionKind {
 					deleteKey := objectMatcher{
 						Namespace: key.namespace,
@@ -40,8 +40,24 @@ type Request struct {
 	Name        string
 	Key         string
 	FromTrigger bool
+	// Cause is why the object is being reconciled
+	Cause Cause
 }
 
+// Cause is the reason a request is being handled.
+type Cause string
+
+const (
+	// CauseChange is a change to the object observed by its watch, or an error requeue
+	CauseChange Cause = "change"
+	// CauseTrigger is a change to another object that this object registered a trigger on
+	CauseTrigger Cause = "trigger"
+	// CauseReplay is a replay of the object
+	CauseReplay Cause = "replay"
+	// CauseScheduled is a periodic resync or scheduled reconcile, see RouteBuilder.ResyncEvery and RouteBuilder.Schedule
+	CauseScheduled Cause = "scheduled"
+)
+
 func (r *Request) WithContext(ctx context.Context) Request {
 	newRequest := *r
 	newRequest.Ctx = ctx
@@ -0,0 +1,124 @@
+package runtime
+
+import (
+	"context"
+	"sort"
+
+	"github.com/obot-platform/nah/pkg/router"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// adminController is implemented by controllers that can be paused and have their backoff cleared.
+type adminController interface {
+	ClearBackoff(key string)
+	Pause()
+	Resume()
+	IsPaused() bool
+}
+
+// ClearBackoff forgets the failures of the key and of the triggers and replays of the key.
+func (c *controller) ClearBackoff(key string) {
+	c.startLock.Lock()
+	defer c.startLock.Unlock()
+
+	if c.workqueues == nil {
+		return
+	}
+	for _, prefix := range router.KeyPrefixes() {
+		c.workqueues[c.splitter.Split(prefix+key)].Forget(prefix + key)
+	}
+}
+
+// Pause stops handling keys. The keys that are dequeued while paused are held and enqueued again by Resume.
+func (c *controller) Pause() {
+	c.startLock.Lock()
+	defer c.startLock.Unlock()
+	c.paused = true
+}
+
+func (c *controller) Resume() {
+	c.startLock.Lock()
+	defer c.startLock.Unlock()
+
+	c.paused = false
+	for key := range c.pausedKeys {
+		l := laneChange
+		if isSpecialKey(key) {
+			l = laneTrigger
+		}
+		c.addLocked(key, 0, l)
+	}
+	c.pausedKeys = nil
+}
+
+func (c *controller) IsPaused() bool {
+	c.startLock.Lock()
+	defer c.startLock.Unlock()
+	return c.paused
+}
+
+// holdIfPaused holds the key until the controller is resumed and returns true if the controller is paused.
+func (c *controller) holdIfPaused(key string) bool {
+	c.startLock.Lock()
+	defer c.startLock.Unlock()
+
+	if !c.paused {
+		return false
+	}
+	if c.pausedKeys == nil {
+		c.pausedKeys = map[string]struct{}{}
+	}
+	c.pausedKeys[key] = struct{}{}
+	return true
+}
+
+func (s *sharedController) admin() (adminController, bool) {
+	c, ok := s.initController().(adminController)
+	return c, ok
+}
+
+func (b *Backend) Enqueue(ctx context.Context, gvk schema.GroupVersionKind, key string) error {
+	controller, err := b.cacheFactory.ForKind(ctx, gvk)
+	if err != nil {
+		return err
+	}
+	controller.EnqueueKey(key)
+	return nil
+}
+
+func (b *Backend) ClearBackoff(ctx context.Context, gvk schema.GroupVersionKind, key string) error {
+	return b.withAdmin(ctx, gvk, func(c adminController) {
+		c.ClearBackoff(key)
+	})
+}
+
+func (b *Backend) Pause(ctx context.Context, gvk schema.GroupVersionKind) error {
+	b.cacheFactory.SetPaused(gvk, true)
+	return b.withAdmin(ctx, gvk, adminController.Pause)
+}
+
+func (b *Backend) Resume(ctx context.Context, gvk schema.GroupVersionKind) error {
+	b.cacheFactory.SetPaused(gvk, false)
+	return b.withAdmin(ctx, gvk, adminController.Resume)
+}
+
+func (b *Backend) PausedGVKs() []schema.GroupVersionKind {
+	gvks := b.cacheFactory.PausedGVKs()
+	sort.Slice(gvks, func(i, j int) bool {
+		return gvks[i].String() < gvks[j].String()
+	})
+	return gvks
+}
+
+func (b *Backend) withAdmin(ctx context.Context, gvk schema.GroupVersionKind, f func(adminController)) error {
+	controller, err := b.cacheFactory.ForKind(ctx, gvk)
+	if err != nil {
+		return err
+	}
+	if s, ok := controller.(*sharedController); ok {
+		if c, ok := s.admin(); ok {
+			f(c)
+		}
+	}
+	return nil
+}
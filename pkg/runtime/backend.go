@@ -15,6 +15,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/openapi3"
 	kcache "k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -36,10 +37,15 @@ func init() {
 type Backend struct {
 	*cacheClient
 
-	cacheFactory SharedControllerFactory
-	cache        cache.Cache
-	startedLock  *sync.RWMutex
-	started      bool
+	cacheFactory  SharedControllerFactory
+	cache         cache.Cache
+	openAPIV3Root openapi3.Root
+	startedLock   *sync.RWMutex
+	started       bool
+
+	watchersLock sync.Mutex
+	// watchers cancel the handler registered by each named watcher of a GVK
+	watchers map[schema.GroupVersionKind]map[string]context.CancelFunc
 }
 
 func newBackend(cacheFactory SharedControllerFactory, client *cacheClient, cache cache.Cache) *Backend {
@@ -48,9 +54,16 @@ func newBackend(cacheFactory SharedControllerFactory, client *cacheClient, cache
 		cacheFactory: cacheFactory,
 		cache:        cache,
 		startedLock:  new(sync.RWMutex),
+		watchers:     map[schema.GroupVersionKind]map[string]context.CancelFunc{},
 	}
 }
 
+// OpenAPIV3Root returns the OpenAPI v3 schemas of the cluster, which apply.New uses to compute patches of
+// custom resources.
+func (b *Backend) OpenAPIV3Root() openapi3.Root {
+	return b.openAPIV3Root
+}
+
 func (b *Backend) Start(ctx context.Context) error {
 	ctx, span := tracer.Start(ctx, "start")
 	defer span.End()
@@ -107,6 +120,10 @@ func (b *Backend) Trigger(ctx context.Context, gvk schema.GroupVersionKind, key
 }
 
 func (b *Backend) addIndexer(ctx context.Context, gvk schema.GroupVersionKind) error {
+	if b.IsMetadataOnly(gvk) {
+		// Field indexes need the full object
+		return nil
+	}
 	obj, err := b.Scheme().New(gvk)
 	if err != nil {
 		return err
@@ -157,16 +174,74 @@ func (b *Backend) Watcher(ctx context.Context, gvk schema.GroupVersionKind, name
 	handler := SharedControllerHandlerFunc(func(ctx context.Context, key string, obj runtime.Object) (runtime.Object, error) {
 		return cb(ctx, gvk, key, obj)
 	})
-	if err := c.RegisterHandler(ctx, fmt.Sprintf("%s %v", name, gvk), handler); err != nil {
+	handlerCtx, cancel := context.WithCancel(ctx)
+	if err := c.RegisterHandler(handlerCtx, fmt.Sprintf("%s %v", name, gvk), handler); err != nil {
+		cancel()
 		return err
 	}
 
+	b.watchersLock.Lock()
+	if b.watchers[gvk] == nil {
+		b.watchers[gvk] = map[string]context.CancelFunc{}
+	}
+	if previous := b.watchers[gvk][name]; previous != nil {
+		previous()
+	}
+	b.watchers[gvk][name] = cancel
+	b.watchersLock.Unlock()
+
 	if b.hasStarted() {
-		return c.Start(ctx, DefaultThreadiness)
+		return c.Start(ctx, b.workers(gvk))
 	}
 	return nil
 }
 
+// RemoveWatcher removes the handler registered by the named watcher of the GVK. The controller and informer of
+// the GVK are removed when it has no more watchers.
+//
+// Cached reads of the client share the informer, and their use of it is not counted. A read of the GVK after the
+// informer is removed starts a new informer and waits for it to sync, and indexes added with IndexField for the GVK
+// are not added to the new informer. Watch the GVK, instead of only reading it, to keep its informer.
+func (b *Backend) RemoveWatcher(ctx context.Context, gvk schema.GroupVersionKind, name string) error {
+	ctx, span := tracer.Start(ctx, "removeWatcher")
+	defer span.End()
+
+	b.watchersLock.Lock()
+	if cancel := b.watchers[gvk][name]; cancel != nil {
+		cancel()
+		delete(b.watchers[gvk], name)
+	}
+	remaining := len(b.watchers[gvk])
+	if remaining == 0 {
+		delete(b.watchers, gvk)
+	}
+	b.watchersLock.Unlock()
+
+	if remaining > 0 {
+		return nil
+	}
+	return b.cacheFactory.RemoveKind(ctx, gvk)
+}
+
+// SetMetadataOnly watches and caches only the metadata of the GVK, as metav1.PartialObjectMetadata, if it is not
+// watched yet. It returns true if only the metadata of the GVK is watched. A full object of the GVK that was read
+// from the cache before keeps its informer.
+func (b *Backend) SetMetadataOnly(gvk schema.GroupVersionKind) bool {
+	if !b.cacheFactory.SetMetadataOnly(gvk) {
+		return false
+	}
+	b.setMetadataOnly(gvk)
+	return true
+}
+
+func (b *Backend) ParkedKeys() []backend.ParkedKey {
+	return b.cacheFactory.ParkedKeys()
+}
+
+func (b *Backend) ReleaseParked(_ context.Context, gvk schema.GroupVersionKind, key string) (bool, error) {
+	return b.cacheFactory.ReleaseParked(gvk, key), nil
+}
+
 func (b *Backend) GroupVersionKindFor(obj runtime.Object) (schema.GroupVersionKind, error) {
 	return b.uncached.GroupVersionKindFor(obj)
 }
@@ -190,11 +265,15 @@ func (b *Backend) GetInformerForKind(ctx context.Context, gvk schema.GroupVersio
 	ctx, span := tracer.Start(ctx, "getInformerForKind")
 	defer span.End()
 
-	i, err := b.cache.GetInformerForKind(ctx, gvk)
+	i, err := getInformer(ctx, b.cache, gvk, b.IsMetadataOnly(gvk))
 	if err != nil {
 		return nil, err
 	}
-	return i.(kcache.SharedIndexInformer), nil
+	sii, ok := i.(kcache.SharedIndexInformer)
+	if !ok {
+		return nil, fmt.Errorf("expecting cache.SharedIndexInformer for %v but got %T", gvk, i)
+	}
+	return sii, nil
 }
 
 func (b *Backend) hasStarted() bool {
@@ -202,3 +281,13 @@ func (b *Backend) hasStarted() bool {
 	defer b.startedLock.RUnlock()
 	return b.started
 }
+
+// workers returns the number of workers of the GVK configured in the factory.
+func (b *Backend) workers(gvk schema.GroupVersionKind) int {
+	if f, ok := b.cacheFactory.(*sharedControllerFactory); ok {
+		if w, err := f.getWorkers(gvk); err == nil {
+			return w
+		}
+	}
+	return DefaultThreadiness
+}
@@ -3,22 +3,29 @@ package runtime
 import (
 	"context"
 	"errors"
+	"maps"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/obot-platform/nah/pkg/untriggered"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
 const (
-	cacheDuration = 10 * time.Second
+	// DefaultRecentWindow is how long writes are remembered so that reads see them before the cache does
+	DefaultRecentWindow = 10 * time.Second
+	// DefaultConsistentReadWait is how long a read waits for the cache to see a minimum resourceVersion
+	DefaultConsistentReadWait = 2 * time.Second
 )
 
 type objectKey struct {
@@ -29,14 +36,23 @@ type objectKey struct {
 type objectValue struct {
 	Object   kclient.Object
 	Inserted time.Time
+	// Deleted records that the object was deleted, Object is the object as it was when it was deleted
+	Deleted bool
 }
 
 type cacheClient struct {
-	uncached kclient.WithWatch
-	cached   kclient.Client
+	uncached  kclient.WithWatch
+	cached    kclient.Client
+	informers cache.Informers
 
-	recent     map[objectKey]objectValue
-	recentLock sync.Mutex
+	recent       map[objectKey]objectValue
+	recentLock   sync.Mutex
+	recentWindow time.Duration
+
+	metadataOnly     map[schema.GroupVersionKind]bool
+	metadataOnlyLock sync.RWMutex
+
+	consistentReadWait time.Duration
 }
 
 func newer(oldRV, newRV string) bool {
@@ -54,27 +70,77 @@ func newer(oldRV, newRV string) bool {
 	return oldI < newI
 }
 
-func newCacheClient(uncached kclient.WithWatch, cached kclient.Client) *cacheClient {
+// newCacheClient returns a client that reads from the cache and remembers its writes for the recent window. A zero
+// window defaults to DefaultRecentWindow and a negative window disables remembering writes.
+func newCacheClient(uncached kclient.WithWatch, cached kclient.Client, informers cache.Informers, cfg Config) *cacheClient {
+	recentWindow := cfg.RecentWritesWindow
+	if recentWindow == 0 {
+		recentWindow = DefaultRecentWindow
+	}
+	consistentReadWait := cfg.ConsistentReadWait
+	if consistentReadWait == 0 {
+		consistentReadWait = DefaultConsistentReadWait
+	}
 	return &cacheClient{
-		uncached: uncached,
-		cached:   cached,
-		recent:   map[objectKey]objectValue{},
+		uncached:           uncached,
+		cached:             cached,
+		informers:          informers,
+		recent:             map[objectKey]objectValue{},
+		recentWindow:       recentWindow,
+		metadataOnly:       maps.Clone(cfg.GVKMetadataOnly),
+		consistentReadWait: consistentReadWait,
 	}
 }
 
+// IsMetadataOnly returns true if only the metadata of the GVK is cached.
+func (c *cacheClient) IsMetadataOnly(gvk schema.GroupVersionKind) bool {
+	c.metadataOnlyLock.RLock()
+	defer c.metadataOnlyLock.RUnlock()
+	return c.metadataOnly[gvk]
+}
+
+func (c *cacheClient) setMetadataOnly(gvk schema.GroupVersionKind) {
+	c.metadataOnlyLock.Lock()
+	defer c.metadataOnlyLock.Unlock()
+	if c.metadataOnly == nil {
+		c.metadataOnly = map[schema.GroupVersionKind]bool{}
+	}
+	c.metadataOnly[gvk] = true
+}
+
+// isUncachedFullObject returns true if obj is a full object of a GVK for which only the metadata is cached.
+// Reading these from the cache would start an informer for the full objects.
+func (c *cacheClient) isUncachedFullObject(obj runtime.Object) bool {
+	switch obj.(type) {
+	case *metav1.PartialObjectMetadata, *metav1.PartialObjectMetadataList:
+		return false
+	}
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return false
+	}
+	if _, ok := obj.(kclient.ObjectList); ok {
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
+	return c.IsMetadataOnly(gvk)
+}
+
 func (c *cacheClient) startPurge(ctx context.Context) {
+	if c.recentWindow < 0 {
+		return
+	}
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-time.After(cacheDuration):
+			case <-time.After(c.recentWindow):
 			}
 
 			now := time.Now()
 			c.recentLock.Lock()
 			for k, v := range c.recent {
-				if v.Inserted.Add(cacheDuration).Before(now) {
+				if v.Inserted.Add(c.recentWindow).Before(now) {
 					delete(c.recent, k)
 				}
 			}
@@ -84,20 +150,37 @@ func (c *cacheClient) startPurge(ctx context.Context) {
 }
 
 func (c *cacheClient) deleteStore(obj kclient.Object) {
+	if c.recentWindow < 0 {
+		return
+	}
 	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
 	if err != nil {
 		return
 	}
-	c.recentLock.Lock()
-	delete(c.recent, objectKey{
+	key := objectKey{
 		gvk:       gvk,
 		namespace: obj.GetNamespace(),
 		name:      obj.GetName(),
-	})
-	c.recentLock.Unlock()
+	}
+	c.recentLock.Lock()
+	defer c.recentLock.Unlock()
+	if obj.GetResourceVersion() == "" || len(obj.GetFinalizers()) > 0 {
+		// Without a resource version it can't be known if the cached object is older than the delete, and an
+		// object with finalizers still exists after it is deleted
+		delete(c.recent, key)
+		return
+	}
+	c.recent[key] = objectValue{
+		Object:   obj.DeepCopyObject().(kclient.Object),
+		Inserted: time.Now(),
+		Deleted:  true,
+	}
 }
 
 func (c *cacheClient) store(obj kclient.Object) {
+	if c.recentWindow < 0 {
+		return
+	}
 	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
 	if err != nil {
 		return
@@ -123,6 +206,13 @@ func (c *cacheClient) Get(ctx context.Context, key kclient.ObjectKey, obj kclien
 		if u.IsUncached() {
 			return c.uncached.Get(ctx, key, obj, opts...)
 		}
+		if rv := u.MinResourceVersion(); rv != "" && !c.waitForResourceVersion(ctx, obj, rv) {
+			return c.uncached.Get(ctx, key, obj, opts...)
+		}
+	}
+
+	if c.isUncachedFullObject(obj) {
+		return c.uncached.Get(ctx, key, obj, opts...)
 	}
 
 	getErr := c.cached.Get(ctx, key, obj)
@@ -137,25 +227,45 @@ func (c *cacheClient) Get(ctx context.Context, key kclient.ObjectKey, obj kclien
 
 	cacheKey := objectKey{
 		gvk:       gvk,
-		namespace: obj.GetNamespace(),
-		name:      obj.GetName(),
+		namespace: key.Namespace,
+		name:      key.Name,
 	}
 
 	c.recentLock.Lock()
 	cachedObj, ok := c.recent[cacheKey]
 	c.recentLock.Unlock()
 
+	if _, partial := cachedObj.Object.(*metav1.PartialObjectMetadata); ok && partial {
+		// The full object can't be filled from only the metadata.
+		_, ok = obj.(*metav1.PartialObjectMetadata)
+	}
+
+	if !ok {
+		return getErr
+	}
+
 	if apierrors.IsNotFound(getErr) {
-		if ok {
-			return CopyInto(obj, cachedObj.Object)
+		if cachedObj.Deleted {
+			recordRecent(ctx, "get", gvk, false)
+			return getErr
 		}
-		return getErr
+		recordRecent(ctx, "get", gvk, true)
+		return CopyInto(obj, cachedObj.Object)
 	}
 
-	if ok && newer(obj.GetResourceVersion(), cachedObj.Object.GetResourceVersion()) {
+	if cachedObj.Deleted && len(obj.GetFinalizers()) == 0 && !newer(cachedObj.Object.GetResourceVersion(), obj.GetResourceVersion()) {
+		// The cache has not seen the delete yet. If the cached object has finalizers, the delete only set its
+		// deletionTimestamp and the object still exists.
+		recordRecent(ctx, "get", gvk, true)
+		return apierrors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}, key.Name)
+	}
+
+	if !cachedObj.Deleted && newer(obj.GetResourceVersion(), cachedObj.Object.GetResourceVersion()) {
+		recordRecent(ctx, "get", gvk, true)
 		return CopyInto(obj, cachedObj.Object)
 	}
 
+	recordRecent(ctx, "get", gvk, false)
 	return nil
 }
 
@@ -168,8 +278,17 @@ func (c *cacheClient) List(ctx context.Context, list kclient.ObjectList, opts ..
 		if u.IsUncached() {
 			return c.uncached.List(ctx, list, opts...)
 		}
+		if rv := u.MinResourceVersion(); rv != "" && !c.waitForResourceVersion(ctx, list, rv) {
+			return c.uncached.List(ctx, list, opts...)
+		}
 	}
-	return c.cached.List(ctx, list, opts...)
+	if c.isUncachedFullObject(list) {
+		return c.uncached.List(ctx, list, opts...)
+	}
+	if err := c.cached.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	return c.mergeRecent(ctx, list, opts...)
 }
 
 func (c *cacheClient) Create(ctx context.Context, obj kclient.Object, opts ...kclient.CreateOption) error {
@@ -218,6 +337,9 @@ func (c *cacheClient) Update(ctx context.Context, obj kclient.Object, opts ...kc
 			return c.uncached.Update(ctx, obj, opts...)
 		}
 	}
+	if err := c.restoreApplied(ctx, obj); err != nil {
+		return err
+	}
 	err := c.cached.Update(ctx, obj, opts...)
 	if err != nil {
 		return err
@@ -236,6 +358,9 @@ func (c *cacheClient) Patch(ctx context.Context, obj kclient.Object, patch kclie
 			return c.uncached.Patch(ctx, obj, patch, opts...)
 		}
 	}
+	if err := checkStrippedPatch(obj, patch); err != nil {
+		return err
+	}
 	err := c.cached.Patch(ctx, obj, patch, opts...)
 	if err != nil {
 		return err
@@ -9,24 +9,81 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/openapi3"
 	"k8s.io/client-go/rest"
+	kcache "k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// DefaultRateLimitBaseDelay is the first delay of the default backoff of keys that fail
+	DefaultRateLimitBaseDelay = 500 * time.Millisecond
+	// DefaultRateLimitMaxDelay is the maximum delay of the default backoff of keys that fail
+	DefaultRateLimitMaxDelay = 15 * time.Minute
+)
+
 type Runtime struct {
 	Backend *Backend
 }
 
 type Config struct {
-	Rest              *rest.Config
-	Namespace         string
+	Rest      *rest.Config
+	Namespace string
+	// Namespaces to cache objects from, in addition to Namespace.
+	Namespaces []string
+	// NamespaceSelector caches objects only from the namespaces with matching labels. Caches are added and removed
+	// as namespaces start and stop matching. If Namespace or Namespaces are set, only those namespaces are selected.
+	NamespaceSelector labels.Selector
 	FieldSelector     fields.Selector
 	LabelSelector     labels.Selector
 	ByObject          map[client.Object]cache.ByObject
+	// DefaultThreadiness is the number of workers of each GVK. Defaults to DefaultThreadiness, which is read from
+	// the NAH_THREADINESS environment variable.
+	DefaultThreadiness int
+	// DefaultRateLimiter delays the retries of keys that fail. Defaults to an exponential backoff from half a
+	// second to 15 minutes.
+	DefaultRateLimiter workqueue.TypedRateLimiter[any]
+	// GVKRateLimiters delay the retries of keys of these GVKs instead of the DefaultRateLimiter.
+	GVKRateLimiters   map[schema.GroupVersionKind]workqueue.TypedRateLimiter[any]
 	GVKThreadiness    map[schema.GroupVersionKind]int
 	GVKQueueSplitters map[schema.GroupVersionKind]WorkerQueueSplitter
+	// GVKFairQueues dequeues the keys of these GVKs fairly between tenants instead of first in, first out.
+	GVKFairQueues map[schema.GroupVersionKind]*FairQueue
+	// GVKPriorityLanes sets the weights of the lanes that watch events, triggers, and retries of these GVKs are
+	// dequeued from.
+	GVKPriorityLanes map[schema.GroupVersionKind]*PriorityLanes
+	// GVKDeadLetters stops retrying keys of these GVKs that fail too many times.
+	GVKDeadLetters map[schema.GroupVersionKind]*DeadLetter
+	// GVKPaused starts the controllers of these GVKs paused. Their keys are held until they are resumed.
+	GVKPaused map[schema.GroupVersionKind]bool
+	// GVKMetadataOnly watches and caches only the metadata of these GVKs as metav1.PartialObjectMetadata. Reads
+	// of the full objects of these GVKs are not cached.
+	GVKMetadataOnly map[schema.GroupVersionKind]bool
+	// GVKTransforms are called, instead of the DefaultTransform, for objects of the GVK before they are stored in
+	// the cache.
+	GVKTransforms map[schema.GroupVersionKind]kcache.TransformFunc
+	// DefaultTransform is called for objects before they are stored in the cache. Defaults to StripTransform if
+	// StripManagedFields or StripAppliedAnnotation is set, otherwise objects are cached as they are.
+	DefaultTransform kcache.TransformFunc
+	// StripManagedFields drops the managedFields of cached objects when DefaultTransform is not set.
+	StripManagedFields bool
+	// StripAppliedAnnotation replaces the applied annotation of cached objects with a placeholder when
+	// DefaultTransform is not set.
+	StripAppliedAnnotation bool
+	// RecentWritesWindow is how long writes made through the client are merged into Get and List results while the
+	// cache catches up. Objects deleted without finalizers are not found during the window even if the cache still
+	// has them. Lists with a limit or continue token are not merged, and lists with a field selector are only merged
+	// if it only uses metadata.name, metadata.namespace, or the fields of types that implement fields.Fields.
+	// Defaults to DefaultRecentWindow, a negative value disables it.
+	RecentWritesWindow time.Duration
+	// ConsistentReadWait is how long reads that require a minimum resourceVersion wait for the cache before they
+	// are read from the API server. Defaults to DefaultConsistentReadWait. When Namespace or Namespaces is set without a
+	// NamespaceSelector, the cache can't tell which resourceVersion it has seen and these reads always go to the API
+	// server. With a NamespaceSelector, the cache waits until the informers of all selected namespaces have seen it.
+	ConsistentReadWait time.Duration
 }
 
 func NewRuntime(cfg *rest.Config, scheme *runtime.Scheme) (*Runtime, error) {
@@ -45,18 +102,40 @@ func NewRuntimeWithConfig(cfg Config, scheme *runtime.Scheme) (*Runtime, error)
 		return nil, err
 	}
 
-	factory := NewSharedControllerFactory(uncachedClient, theCache, &SharedControllerFactoryOptions{
-		KindWorkers:       cfg.GVKThreadiness,
-		KindQueueSplitter: cfg.GVKQueueSplitters,
+	rateLimiter := cfg.DefaultRateLimiter
+	if rateLimiter == nil {
 		// In nah this is only invoked when a key fails to process
-		DefaultRateLimiter: workqueue.NewTypedMaxOfRateLimiter(
+		rateLimiter = workqueue.NewTypedMaxOfRateLimiter(
 			// This will go .5, 1, 2, 4, 8 seconds, etc up until 15 minutes
-			workqueue.NewTypedItemExponentialFailureRateLimiter[any](500*time.Millisecond, 15*time.Minute),
-		),
+			workqueue.NewTypedItemExponentialFailureRateLimiter[any](DefaultRateLimitBaseDelay, DefaultRateLimitMaxDelay),
+		)
+	}
+
+	factory := NewSharedControllerFactory(uncachedClient, theCache, &SharedControllerFactoryOptions{
+		DefaultWorkers:     cfg.DefaultThreadiness,
+		DefaultRateLimiter: rateLimiter,
+		KindRateLimiter:    cfg.GVKRateLimiters,
+		KindWorkers:        cfg.GVKThreadiness,
+		KindQueueSplitter:  cfg.GVKQueueSplitters,
+		KindFairQueue:      cfg.GVKFairQueues,
+		KindPriorityLanes:  cfg.GVKPriorityLanes,
+		KindDeadLetter:     cfg.GVKDeadLetters,
+		KindPaused:         cfg.GVKPaused,
+		KindMetadataOnly:   cfg.GVKMetadataOnly,
 	})
 
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg.Rest)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := newBackend(factory, newCacheClient(uncachedClient, cachedClient, theCache, cfg), theCache)
+	// The OpenAPI client is not cached: client-go's cached client keeps failed lookups forever, which hides
+	// the schemas of CRDs created after the first lookup. Schemas are cached by pkg/apply instead.
+	backend.openAPIV3Root = openapi3.NewRoot(discoveryClient.OpenAPIV3())
+
 	return &Runtime{
-		Backend: newBackend(factory, newCacheClient(uncachedClient, cachedClient), theCache),
+		Backend: backend,
 	}, nil
 }
 
@@ -82,13 +161,21 @@ func getClients(cfg Config, scheme *runtime.Scheme) (uncachedClient client.WithW
 		return nil, nil, nil, err
 	}
 
-	var namespaces map[string]cache.Config
+	var namespaceNames []string
 	if cfg.Namespace != "" {
+		namespaceNames = append(namespaceNames, cfg.Namespace)
+	}
+	namespaceNames = append(namespaceNames, cfg.Namespaces...)
+
+	var namespaces map[string]cache.Config
+	if len(namespaceNames) > 0 {
 		namespaces = map[string]cache.Config{}
-		namespaces[cfg.Namespace] = cache.Config{}
+		for _, ns := range namespaceNames {
+			namespaces[ns] = cache.Config{}
+		}
 	}
 
-	theCache, err = cache.New(cfg.Rest, cache.Options{
+	cacheOpts := cache.Options{
 		HTTPClient:           httpClient,
 		Mapper:               mapper,
 		Scheme:               scheme,
@@ -96,7 +183,15 @@ func getClients(cfg Config, scheme *runtime.Scheme) (uncachedClient client.WithW
 		DefaultFieldSelector: cfg.FieldSelector,
 		DefaultLabelSelector: cfg.LabelSelector,
 		ByObject:             cfg.ByObject,
-	})
+		DefaultTransform:     cacheTransform(cfg, scheme),
+	}
+
+	if cfg.NamespaceSelector != nil {
+		cacheOpts.DefaultNamespaces = nil
+		theCache, err = newNamespaceSelectorCache(cfg.Rest, cacheOpts, cfg.NamespaceSelector, namespaceNames)
+	} else {
+		theCache, err = cache.New(cfg.Rest, cacheOpts)
+	}
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -0,0 +1,106 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/obot-platform/nah/pkg/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// resourceVersioned is implemented by informers that know the last resourceVersion they have seen.
+type resourceVersioned interface {
+	LastSyncResourceVersion() string
+}
+
+// unversionedInformers are the GVKs whose informers don't know their last resourceVersion, so that the fallback
+// is only logged once for each.
+var unversionedInformers sync.Map
+
+// waitForResourceVersion waits until the informer for obj, an object or a list, has seen at least the resourceVersion.
+// It returns false if the informer did not catch up in time, or if it can't be known, in which case the read should
+// not be served from the cache. The informers that controller-runtime creates when Namespace or Namespaces is set
+// without a NamespaceSelector don't expose their resourceVersion, so these reads always go to the API server. With a
+// NamespaceSelector, the oldest resourceVersion seen by the informers of the selected namespaces is used, see
+// multiInformer.LastSyncResourceVersion.
+func (c *cacheClient) waitForResourceVersion(ctx context.Context, obj runtime.Object, resourceVersion string) bool {
+	if c.isUncachedFullObject(obj) {
+		// This is read from the API server anyway
+		return true
+	}
+
+	item, err := c.informerObject(obj)
+	if err != nil {
+		return false
+	}
+
+	informer, err := c.informers.GetInformer(ctx, item)
+	if err != nil {
+		return false
+	}
+
+	versioned, ok := informer.(resourceVersioned)
+	if !ok {
+		if gvk, err := apiutil.GVKForObject(item, c.Scheme()); err == nil {
+			if _, logged := unversionedInformers.LoadOrStore(gvk, true); !logged {
+				log.Infof("Informer of %s does not expose its resourceVersion, reads that require a minimum resourceVersion are served by the API server", gvk)
+			}
+		}
+		return false
+	}
+
+	if !newer(versioned.LastSyncResourceVersion(), resourceVersion) {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.consistentReadWait)
+	defer cancel()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			if !newer(versioned.LastSyncResourceVersion(), resourceVersion) {
+				return true
+			}
+		}
+	}
+}
+
+// informerObject returns an object of the type the cache uses to find the informer that would serve reads of obj.
+func (c *cacheClient) informerObject(obj runtime.Object) (kclient.Object, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return nil, err
+	}
+
+	switch obj.(type) {
+	case *metav1.PartialObjectMetadata, *metav1.PartialObjectMetadataList:
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+		return newPartialObjectMetadata(gvk), nil
+	case *unstructured.Unstructured, *unstructured.UnstructuredList:
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		return u, nil
+	case kclient.Object:
+		return obj.(kclient.Object), nil
+	}
+
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	newObj, err := c.Scheme().New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return newObj.(kclient.Object), nil
+}
@@ -3,11 +3,14 @@ package runtime
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/obot-platform/nah/pkg/backend"
 	"github.com/obot-platform/nah/pkg/log"
+	"github.com/obot-platform/nah/pkg/router"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	apierror "k8s.io/apimachinery/pkg/api/errors"
@@ -62,16 +65,61 @@ type controller struct {
 	obj          runtime.Object
 	cache        cache.Cache
 	splitter     WorkerQueueSplitter
+	metadataOnly bool
+	fairQueue    *FairQueue
+	fairQueues   []*fairQueue
+	lanes        []*laneQueue
+	lanesConfig  *PriorityLanes
+	deadLetter   *DeadLetter
+	client       kclient.Client
+	stop         context.CancelFunc
+
+	parkedLock sync.Mutex
+	// parked are the objects whose keys are not retried, by namespace/name
+	parked map[string]backend.ParkedKey
+	// settingCondition are the parked objects whose condition is being set, with the resourceVersions of the changes
+	// seen in the meantime
+	settingCondition map[string][]string
+	// syncingCondition are the objects whose condition is being written, true if it must be written again
+	syncingCondition map[string]bool
+	// clearCondition are the released objects whose parked condition is removed when they succeed
+	clearCondition map[string]bool
+	// removeCondition are the objects whose parked condition is waiting to be removed
+	removeCondition map[string]bool
+
+	// paused and pausedKeys, the keys dequeued while paused, are guarded by the startLock
+	paused     bool
+	pausedKeys map[string]struct{}
+
+	// drained is closed when the workers have stopped, it is guarded by the startLock
+	drained   chan struct{}
+	drainLock sync.Mutex
+	// inFlight counts the keys being handled and pending are the keys dropped when the workqueues were shut down
+	inFlight map[string]int
+	pending  []string
 }
 
 type startKey struct {
 	key   string
 	after time.Duration
+	lane  lane
 }
 
 type Options struct {
 	RateLimiter   workqueue.TypedRateLimiter[any]
 	QueueSplitter WorkerQueueSplitter
+	// MetadataOnly watches and caches only the metadata of the objects as metav1.PartialObjectMetadata
+	MetadataOnly bool
+	// FairQueue, if set, dequeues keys fairly between tenants, by default namespaces, instead of first in, first out
+	FairQueue *FairQueue
+	// PriorityLanes sets the weights of the lanes that watch events, triggers, and retries are dequeued from
+	PriorityLanes *PriorityLanes
+	// DeadLetter, if set, stops retrying keys that fail too many times
+	DeadLetter *DeadLetter
+	// Client is used to update the status of objects, such as the condition of parked keys
+	Client kclient.Client
+	// Paused starts the controller paused, see Pause
+	Paused bool
 }
 
 type WorkerQueueSplitter interface {
@@ -89,34 +137,65 @@ func (*singleWorkerQueueSplitter) Split(string) int {
 	return 0
 }
 
+// NewHashQueueSplitter returns a WorkerQueueSplitter that splits keys between the queues by their hash.
+func NewHashQueueSplitter(queues int) WorkerQueueSplitter {
+	return hashQueueSplitter(queues)
+}
+
+type hashQueueSplitter int
+
+func (h hashQueueSplitter) Queues() int {
+	return int(h)
+}
+
+func (h hashQueueSplitter) Split(key string) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(h))
+}
+
 func New(ctx context.Context, gvk schema.GroupVersionKind, scheme *runtime.Scheme, cache cache.Cache, handler Handler, opts *Options) (Controller, error) {
 	opts = applyDefaultOptions(opts)
 
-	obj, err := newObject(scheme, gvk)
+	obj, err := newObject(scheme, gvk, opts.MetadataOnly)
 	if err != nil {
 		return nil, err
 	}
 
-	informer, err := cache.GetInformerForKind(ctx, gvk)
+	informer, err := getInformer(ctx, cache, gvk, opts.MetadataOnly)
 	if err != nil {
 		return nil, err
 	}
 
 	controller := &controller{
-		gvk:         gvk,
-		name:        gvk.String(),
-		handler:     handler,
-		cache:       cache,
-		obj:         obj,
-		rateLimiter: opts.RateLimiter,
-		informer:    informer,
-		splitter:    opts.QueueSplitter,
+		gvk:              gvk,
+		name:             gvk.String(),
+		handler:          handler,
+		cache:            cache,
+		obj:              obj,
+		rateLimiter:      opts.RateLimiter,
+		informer:         informer,
+		splitter:         opts.QueueSplitter,
+		metadataOnly:     opts.MetadataOnly,
+		fairQueue:        opts.FairQueue,
+		lanesConfig:      opts.PriorityLanes,
+		deadLetter:       opts.DeadLetter,
+		client:           opts.Client,
+		parked:           map[string]backend.ParkedKey{},
+		settingCondition: map[string][]string{},
+		syncingCondition: map[string]bool{},
+		clearCondition:   map[string]bool{},
+		removeCondition:  map[string]bool{},
+		paused:           opts.Paused,
 	}
 
 	return controller, nil
 }
 
-func newObject(scheme *runtime.Scheme, gvk schema.GroupVersionKind) (runtime.Object, error) {
+func newObject(scheme *runtime.Scheme, gvk schema.GroupVersionKind, metadataOnly bool) (runtime.Object, error) {
+	if metadataOnly {
+		return newPartialObjectMetadata(gvk), nil
+	}
 	obj, err := scheme.New(gvk)
 	if runtime.IsNotRegisteredError(err) {
 		return &unstructured.Unstructured{}, nil
@@ -124,6 +203,20 @@ func newObject(scheme *runtime.Scheme, gvk schema.GroupVersionKind) (runtime.Obj
 	return obj, err
 }
 
+func newPartialObjectMetadata(gvk schema.GroupVersionKind) *metav1.PartialObjectMetadata {
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(gvk)
+	return obj
+}
+
+// getInformer returns the informer for the GVK, which only caches metav1.PartialObjectMetadata if metadataOnly is set.
+func getInformer(ctx context.Context, c cache.Cache, gvk schema.GroupVersionKind, metadataOnly bool) (cache.Informer, error) {
+	if metadataOnly {
+		return c.GetInformer(ctx, newPartialObjectMetadata(gvk))
+	}
+	return c.GetInformerForKind(ctx, gvk)
+}
+
 func applyDefaultOptions(opts *Options) *Options {
 	var newOpts Options
 	if opts != nil {
@@ -160,19 +253,21 @@ func (c *controller) run(ctx context.Context, workers int) {
 	// a mechanism to Shutdown it down.  Without the stopCh we don't know when to shutdown
 	// the queue and release the goroutine
 	c.workqueues = make([]workqueue.TypedRateLimitingInterface[any], c.splitter.Queues())
+	c.lanes = make([]*laneQueue, len(c.workqueues))
 	for i := range c.workqueues {
-		c.workqueues[i] = workqueue.NewTypedRateLimitingQueueWithConfig(c.rateLimiter, workqueue.TypedRateLimitingQueueConfig[any]{Name: fmt.Sprintf("%s-%d", c.name, i)})
+		var fairQueues []*fairQueue
+		c.workqueues[i], c.lanes[i], fairQueues = newRateLimitingQueue(fmt.Sprintf("%s-%d", c.name, i), c.rateLimiter, c.lanesConfig, c.fairQueue)
+		c.fairQueues = append(c.fairQueues, fairQueues...)
 	}
 	for _, start := range c.startKeys {
-		if start.after == 0 {
-			c.workqueues[c.splitter.Split(start.key)].Add(start.key)
-		} else {
-			c.workqueues[c.splitter.Split(start.key)].AddAfter(start.key, start.after)
-		}
+		c.addLocked(start.key, start.after, start.lane)
 	}
 	c.startKeys = nil
+	drained := c.drained
 	c.startLock.Unlock()
 
+	defer close(drained)
+
 	defer utilruntime.HandleCrash()
 
 	// Start the informer factories to begin populating the informer caches
@@ -183,6 +278,10 @@ func (c *controller) run(ctx context.Context, workers int) {
 	c.startLock.Lock()
 	defer c.startLock.Unlock()
 	c.started = false
+	for _, fair := range c.fairQueues {
+		fair.close()
+	}
+	c.fairQueues = nil
 	log.Infof("Shutting down %s workers", c.name)
 }
 
@@ -201,7 +300,7 @@ func (c *controller) Start(ctx context.Context, workers int) error {
 	}
 
 	if c.informer == nil {
-		informer, err := c.cache.GetInformerForKind(ctx, c.gvk)
+		informer, err := getInformer(ctx, c.cache, c.gvk, c.metadataOnly)
 		if err != nil {
 			return err
 		}
@@ -214,10 +313,8 @@ func (c *controller) Start(ctx context.Context, workers int) error {
 
 	if c.registration == nil {
 		registration, err := c.informer.AddEventHandler(clientgocache.ResourceEventHandlerFuncs{
-			AddFunc: c.handleObject,
-			UpdateFunc: func(old, new any) {
-				c.handleObject(new)
-			},
+			AddFunc:    c.handleObject,
+			UpdateFunc: c.handleUpdate,
 			DeleteFunc: c.handleObject,
 		})
 		if err != nil {
@@ -238,24 +335,47 @@ func (c *controller) Start(ctx context.Context, workers int) error {
 	}
 
 	span.AddEvent("starting workers")
-	go c.run(ctx, workers)
+	runCtx, stop := context.WithCancel(ctx)
+	c.stop = stop
+	c.drained = make(chan struct{})
+	c.drainLock.Lock()
+	c.inFlight = map[string]int{}
+	c.pending = nil
+	c.drainLock.Unlock()
+	go c.run(runCtx, workers)
 	c.started = true
 	return nil
 }
 
+// Stop stops the workers of the controller. The informer is left running.
+func (c *controller) Stop() {
+	c.startLock.Lock()
+	defer c.startLock.Unlock()
+	if c.stop != nil {
+		c.stop()
+		c.stop = nil
+	}
+}
+
 func (c *controller) runWorkers(ctx context.Context, workers int) {
 	wait := sync.WaitGroup{}
+	loops := sync.WaitGroup{}
 	workers = workers / len(c.workqueues)
 	if workers == 0 {
 		workers = 1
 	}
 
+	// The workers are waited for without a limit, because handlers can't be stopped. Drain stops waiting for them
+	// at its timeout, but run returns only once they do.
 	defer func() {
 		defer wait.Wait()
+		defer loops.Wait()
 	}()
 
 	for _, queue := range c.workqueues {
+		loops.Add(1)
 		go func() {
+			defer loops.Done()
 			// This channel acts as a semaphore to limit the number of concurrent
 			// work items handled by this controller.
 			running := make(chan struct{}, workers)
@@ -267,19 +387,28 @@ func (c *controller) runWorkers(ctx context.Context, workers int) {
 					return
 				}
 
+				if queue.ShuttingDown() {
+					// Don't wait for a worker to record the keys that won't be handled
+					c.dropPending(queue, obj)
+					return
+				}
+
 				// Acquire from the semaphore
 				running <- struct{}{}
 
 				if queue.ShuttingDown() {
 					// If we acquired after the workers were shutdown,
 					// then drop this object and return instead of trying to add to the wait group, which will panic.
+					c.dropPending(queue, obj)
 					return
 				}
 
 				wait.Add(1)
+				c.startInFlight(obj)
 
 				go func() {
 					defer func() {
+						c.doneInFlight(obj)
 						// Release to the semaphore
 						<-running
 						wait.Done()
@@ -321,26 +450,42 @@ func (c *controller) processSingleItem(ctx context.Context, queue workqueue.Type
 		log.Errorf("expected string in workqueue but got %#v", obj)
 		return nil
 	}
+	if c.holdIfPaused(key) {
+		queue.Forget(obj)
+		return nil
+	}
 	if err := c.syncHandler(ctx, key); err != nil {
-		queue.AddRateLimited(key)
+		if c.handleFailure(ctx, key, queue.NumRequeues(key)+1, err) {
+			queue.Forget(obj)
+			return fmt.Errorf("error syncing '%s': %s, parked", key, err.Error())
+		}
+		// The lane is added with the key so that the retry is not handled as a change if one comes in meanwhile
+		queue.AddAfter(laneKey{item: key, lane: laneRetry}, c.rateLimiter.When(key))
 		return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
 	}
 
 	queue.Forget(obj)
+	c.handleSuccess(ctx, key)
 	return nil
 }
 
 func isSpecialKey(key string) bool {
-	// This matches "_t " and "_r " prefixes
+	// This matches "_t ", "_r ", and "_s " prefixes
 	return len(key) > 2 && key[0] == '_' && key[2] == ' '
 }
 
 func (c *controller) syncHandler(ctx context.Context, key string) error {
+	ns, name := KeyParse(key)
+	if selector, ok := c.cache.(namespaceSelector); ok && !selector.namespaceSelected(ns) {
+		// The namespace is no longer selected, so its objects, triggers, and schedules are dropped instead of retried
+		log.Debugf("Dropping [%s] [%v], namespace %s is not selected", key, c.gvk, ns)
+		return nil
+	}
+
 	if isSpecialKey(key) {
 		return c.handler.OnChange(ctx, key, nil)
 	}
 
-	ns, name := KeyParse(key)
 	obj := c.obj.DeepCopyObject().(kclient.Object)
 	err := c.cache.Get(ctx, kclient.ObjectKey{
 		Name:      name,
@@ -355,18 +500,41 @@ func (c *controller) syncHandler(ctx context.Context, key string) error {
 	return c.handler.OnChange(ctx, key, obj.(runtime.Object))
 }
 
+// namespaceSelector is implemented by caches that only cache objects of some namespaces.
+type namespaceSelector interface {
+	namespaceSelected(namespace string) bool
+}
+
 func (c *controller) EnqueueKey(key string) {
 	c.EnqueueKeyAfter(key, 0)
 }
 
 func (c *controller) EnqueueKeyAfter(key string, after time.Duration) {
+	if strings.HasPrefix(key, router.TriggerPrefix+router.ScheduledPrefix) {
+		// Scheduled reconciles are periodic resyncs
+		c.add(key, after, laneRetry)
+		return
+	}
+	c.add(key, after, laneTrigger)
+}
+
+// add enqueues the key in the lane after the delay, or when the workers are started.
+func (c *controller) add(key string, after time.Duration, l lane) {
 	c.startLock.Lock()
 	defer c.startLock.Unlock()
+	c.addLocked(key, after, l)
+}
 
+func (c *controller) addLocked(key string, after time.Duration, l lane) {
 	if c.workqueues == nil {
-		c.startKeys = append(c.startKeys, startKey{key: key, after: after})
+		c.startKeys = append(c.startKeys, startKey{key: key, after: after, lane: l})
+		return
+	}
+	i := c.splitter.Split(key)
+	if after == 0 {
+		c.workqueues[i].Add(laneKey{item: key, lane: l})
 	} else {
-		c.workqueues[c.splitter.Split(key)].AddAfter(key, after)
+		c.workqueues[i].AddAfter(laneKey{item: key, lane: l}, after)
 	}
 }
 
@@ -375,25 +543,15 @@ func (c *controller) Enqueue(namespace, name string) {
 }
 
 func (c *controller) EnqueueAfter(namespace, name string, duration time.Duration) {
-	key := keyFunc(namespace, name)
-
-	c.startLock.Lock()
-	defer c.startLock.Unlock()
-
-	if c.workqueues == nil {
-		c.startKeys = append(c.startKeys, startKey{key: key, after: duration})
-	} else {
-		c.workqueues[c.splitter.Split(key)].AddAfter(key, duration)
-	}
+	c.add(keyFunc(namespace, name), duration, laneTrigger)
 }
 
 func KeyParse(key string) (namespace string, name string) {
-	special, key, ok := strings.Cut(key, " ")
-	if !ok {
-		key = special
+	for isSpecialKey(key) {
+		key = key[3:]
 	}
 
-	namespace, name, ok = strings.Cut(key, "/")
+	namespace, name, ok := strings.Cut(key, "/")
 	if !ok {
 		name = namespace
 		namespace = ""
@@ -408,20 +566,32 @@ func keyFunc(namespace, name string) string {
 	return namespace + "/" + name
 }
 
-func (c *controller) enqueue(obj any) {
+func (c *controller) enqueue(obj any, l lane) {
 	var key string
 	var err error
 	if key, err = clientgocache.MetaNamespaceKeyFunc(obj); err != nil {
 		log.Errorf("%v", err)
 		return
 	}
-	c.startLock.Lock()
-	if c.workqueues == nil {
-		c.startKeys = append(c.startKeys, startKey{key: key})
-	} else {
-		c.workqueues[c.splitter.Split(key)].Add(key)
+	if m, ok := obj.(metav1.Object); ok {
+		if l == laneRetry && c.isParked(key, m.GetResourceVersion()) {
+			// Resyncs don't retry parked keys
+			return
+		}
+		c.releaseChanged(key, m.GetResourceVersion())
 	}
-	c.startLock.Unlock()
+	c.add(key, 0, l)
+}
+
+func (c *controller) handleUpdate(oldObj, newObj any) {
+	oldMeta, oldOK := oldObj.(metav1.Object)
+	newMeta, newOK := newObj.(metav1.Object)
+	if oldOK && newOK && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+		// Nothing changed, this is a periodic resync of the informer
+		c.enqueue(newObj, laneRetry)
+		return
+	}
+	c.handleObject(newObj)
 }
 
 func (c *controller) handleObject(obj any) {
@@ -438,5 +608,5 @@ func (c *controller) handleObject(obj any) {
 		}
 		obj = newObj
 	}
-	c.enqueue(obj)
+	c.enqueue(obj, laneChange)
 }
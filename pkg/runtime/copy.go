@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"reflect"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
 func CopyInto(dst, src runtime.Object) error {
-	if _, ok := src.(*unstructured.Unstructured); ok {
+	_, partial := dst.(*metav1.PartialObjectMetadata)
+	if _, ok := src.(*unstructured.Unstructured); ok || partial {
 		data, err := json.Marshal(src)
 		if err != nil {
 			return err
@@ -0,0 +1,287 @@
+package runtime
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/obot-platform/nah/pkg/backend"
+	"github.com/obot-platform/nah/pkg/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ParkedReason is the reason of the condition set on objects whose key is parked.
+const ParkedReason = "MaxAttemptsExceeded"
+
+// DeadLetter configures a controller to stop retrying keys that keep failing. After MaxAttempts failures in a row
+// the key is parked: it is not retried again until the object changes, it is released, or a trigger enqueues it
+// and it succeeds.
+type DeadLetter struct {
+	// MaxAttempts is the number of times a key is handled before it is parked. Zero never parks keys.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// Condition, if set, is the type of a condition set on the status of parked objects that have conditions. It
+	// is removed when the key succeeds after it is released.
+	Condition string `json:"condition,omitempty"`
+}
+
+type conditionsObject interface {
+	kclient.Object
+	GetConditions() *[]metav1.Condition
+}
+
+// handleFailure records the failure of the key and returns true if the key is parked and should not be retried. Keys
+// are parked by object, so the triggers and schedules of a parked object are parked with it. The condition is
+// written by another goroutine so that the status write doesn't hold up the worker.
+func (c *controller) handleFailure(ctx context.Context, key string, attempts int, handlerErr error) bool {
+	if c.deadLetter == nil || c.deadLetter.MaxAttempts <= 0 {
+		return false
+	}
+
+	objKey := parkKey(key)
+	c.parkedLock.Lock()
+	parked, isParked := c.parked[objKey]
+	c.parkedLock.Unlock()
+
+	if !isParked && attempts < c.deadLetter.MaxAttempts {
+		return false
+	}
+
+	if !isParked {
+		parked = backend.ParkedKey{
+			GVK:   c.gvk,
+			Key:   objKey,
+			Since: time.Now(),
+		}
+		log.Errorf("Parking [%s] [%v] after %d failed attempts: %v", key, c.gvk, attempts, handlerErr)
+	}
+	parked.Attempts += attempts
+	parked.Error = handlerErr.Error()
+	parked.ResourceVersion = c.cachedResourceVersion(ctx, objKey)
+
+	c.parkedLock.Lock()
+	c.parked[objKey] = parked
+	c.parkedLock.Unlock()
+
+	if c.deadLetter.Condition != "" {
+		c.syncCondition(ctx, objKey)
+	}
+	return true
+}
+
+// handleSuccess releases the object of the key if it is parked and removes the parked condition if it was set.
+func (c *controller) handleSuccess(ctx context.Context, key string) {
+	if c.deadLetter == nil {
+		return
+	}
+
+	objKey := parkKey(key)
+	c.parkedLock.Lock()
+	_, isParked := c.parked[objKey]
+	delete(c.parked, objKey)
+	removeCondition := (c.clearCondition[objKey] || isParked) && c.deadLetter.Condition != ""
+	delete(c.clearCondition, objKey)
+	if removeCondition {
+		c.removeCondition[objKey] = true
+	}
+	c.parkedLock.Unlock()
+
+	if removeCondition {
+		c.syncCondition(ctx, objKey)
+	}
+}
+
+// syncCondition makes the parked condition of the object match whether it is parked. The writes of an object are
+// made one at a time by a goroutine, which writes again if the object changed in the meantime.
+func (c *controller) syncCondition(ctx context.Context, objKey string) {
+	c.parkedLock.Lock()
+	if _, syncing := c.syncingCondition[objKey]; syncing {
+		c.syncingCondition[objKey] = true
+		c.parkedLock.Unlock()
+		return
+	}
+	c.syncingCondition[objKey] = false
+	c.parkedLock.Unlock()
+
+	go func() {
+		for {
+			c.writeCondition(ctx, objKey)
+
+			c.parkedLock.Lock()
+			if !c.syncingCondition[objKey] {
+				delete(c.syncingCondition, objKey)
+				c.parkedLock.Unlock()
+				return
+			}
+			c.syncingCondition[objKey] = false
+			c.parkedLock.Unlock()
+		}
+	}()
+}
+
+func (c *controller) writeCondition(ctx context.Context, objKey string) {
+	c.parkedLock.Lock()
+	parked, isParked := c.parked[objKey]
+	removeCondition := c.removeCondition[objKey]
+	delete(c.removeCondition, objKey)
+	if isParked {
+		c.settingCondition[objKey] = nil
+	}
+	c.parkedLock.Unlock()
+
+	if !isParked {
+		if removeCondition {
+			c.removeParkedCondition(ctx, objKey)
+		}
+		return
+	}
+
+	// The object is parked before the condition is set so that the change made by the condition doesn't release it
+	rv, updated := c.setParkedCondition(ctx, objKey, parked.Error)
+
+	c.parkedLock.Lock()
+	defer c.parkedLock.Unlock()
+
+	seen := c.settingCondition[objKey]
+	delete(c.settingCondition, objKey)
+	current, ok := c.parked[objKey]
+	if !ok {
+		// Released while the condition was set
+		return
+	}
+	for _, seenRV := range seen {
+		if seenRV != current.ResourceVersion && (!updated || seenRV != rv) {
+			// The object was changed by someone else while the condition was set, its watch event enqueued it
+			c.releaseLocked(objKey)
+			return
+		}
+	}
+	if updated {
+		current.ResourceVersion = rv
+		c.parked[objKey] = current
+	}
+}
+
+// releaseChanged releases the parked object if its resourceVersion is not the one that was parked.
+func (c *controller) releaseChanged(key, resourceVersion string) {
+	if c.deadLetter == nil {
+		return
+	}
+
+	c.parkedLock.Lock()
+	defer c.parkedLock.Unlock()
+	if seen, ok := c.settingCondition[key]; ok {
+		// writeCondition decides once it knows the resourceVersion of the condition
+		c.settingCondition[key] = append(seen, resourceVersion)
+		return
+	}
+	if parked, ok := c.parked[key]; ok && parked.ResourceVersion != resourceVersion {
+		c.releaseLocked(key)
+	}
+}
+
+func (c *controller) releaseLocked(objKey string) {
+	delete(c.parked, objKey)
+	if c.deadLetter.Condition != "" {
+		c.clearCondition[objKey] = true
+	}
+}
+
+// isParked returns true if the object is parked with the resourceVersion.
+func (c *controller) isParked(key, resourceVersion string) bool {
+	if c.deadLetter == nil {
+		return false
+	}
+	c.parkedLock.Lock()
+	defer c.parkedLock.Unlock()
+	parked, ok := c.parked[key]
+	return ok && parked.ResourceVersion == resourceVersion
+}
+
+// ParkedKeys returns the keys that are parked, oldest first.
+func (c *controller) ParkedKeys() []backend.ParkedKey {
+	c.parkedLock.Lock()
+	defer c.parkedLock.Unlock()
+
+	result := make([]backend.ParkedKey, 0, len(c.parked))
+	for _, parked := range c.parked {
+		result = append(result, parked)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Since.Before(result[j].Since)
+	})
+	return result
+}
+
+// ReleaseParked releases the parked object and enqueues it. It returns false if it was not parked.
+func (c *controller) ReleaseParked(key string) bool {
+	c.parkedLock.Lock()
+	_, ok := c.parked[key]
+	if ok {
+		c.releaseLocked(key)
+	}
+	c.parkedLock.Unlock()
+
+	if ok {
+		c.add(key, 0, laneTrigger)
+	}
+	return ok
+}
+
+// parkKey returns the namespace/name key of a workqueue key without its special prefixes.
+func parkKey(key string) string {
+	return keyFunc(KeyParse(key))
+}
+
+func (c *controller) cachedResourceVersion(ctx context.Context, key string) string {
+	ns, name := KeyParse(key)
+	obj := c.obj.DeepCopyObject().(kclient.Object)
+	if err := c.cache.Get(ctx, kclient.ObjectKey{Namespace: ns, Name: name}, obj); err != nil {
+		return ""
+	}
+	return obj.GetResourceVersion()
+}
+
+// updateCondition gets the object from the API server, changes its conditions, and updates its status if they
+// changed. It returns the new resourceVersion of the object and true if it was updated.
+func (c *controller) updateCondition(ctx context.Context, key string, change func(conditions *[]metav1.Condition, generation int64) bool) (string, bool) {
+	if c.client == nil {
+		return "", false
+	}
+
+	ns, name := KeyParse(key)
+	obj, ok := c.obj.DeepCopyObject().(conditionsObject)
+	if !ok {
+		return "", false
+	}
+	if err := c.client.Get(ctx, kclient.ObjectKey{Namespace: ns, Name: name}, obj); err != nil {
+		return "", false
+	}
+	if !change(obj.GetConditions(), obj.GetGeneration()) {
+		return "", false
+	}
+	if err := c.client.Status().Update(ctx, obj); err != nil {
+		log.Errorf("Failed to update the %s condition of [%s] [%v]: %v", c.deadLetter.Condition, key, c.gvk, err)
+		return "", false
+	}
+	return obj.GetResourceVersion(), true
+}
+
+func (c *controller) setParkedCondition(ctx context.Context, key, message string) (string, bool) {
+	return c.updateCondition(ctx, key, func(conditions *[]metav1.Condition, generation int64) bool {
+		return meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:               c.deadLetter.Condition,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: generation,
+			Reason:             ParkedReason,
+			Message:            message,
+		})
+	})
+}
+
+func (c *controller) removeParkedCondition(ctx context.Context, key string) {
+	c.updateCondition(ctx, key, func(conditions *[]metav1.Condition, _ int64) bool {
+		return meta.RemoveStatusCondition(conditions, c.deadLetter.Condition)
+	})
+}
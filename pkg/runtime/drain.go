@@ -0,0 +1,122 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/obot-platform/nah/pkg/backend"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+)
+
+type drainController interface {
+	Drain(ctx context.Context) backend.DrainStatus
+}
+
+func (c *controller) startInFlight(obj any) {
+	c.drainLock.Lock()
+	defer c.drainLock.Unlock()
+	c.inFlight[fmt.Sprint(obj)]++
+}
+
+func (c *controller) doneInFlight(obj any) {
+	c.drainLock.Lock()
+	defer c.drainLock.Unlock()
+	key := fmt.Sprint(obj)
+	if c.inFlight[key]--; c.inFlight[key] <= 0 {
+		delete(c.inFlight, key)
+	}
+}
+
+// dropPending records the item, and every item left in the queue, as pending. The queue must be shut down.
+func (c *controller) dropPending(queue workqueue.TypedRateLimitingInterface[any], obj any) {
+	c.drainLock.Lock()
+	defer c.drainLock.Unlock()
+
+	for {
+		c.pending = append(c.pending, fmt.Sprint(obj))
+		queue.Done(obj)
+
+		var shutdown bool
+		if obj, shutdown = queue.Get(); shutdown {
+			return
+		}
+	}
+}
+
+// Drain waits for the workers of the controller to stop after its context is done. If ctx is done first, the keys
+// that are still being handled are returned as in flight.
+func (c *controller) Drain(ctx context.Context) backend.DrainStatus {
+	c.startLock.Lock()
+	drained := c.drained
+	c.startLock.Unlock()
+
+	status := backend.DrainStatus{
+		GVK:     c.gvk,
+		Drained: true,
+	}
+	if drained != nil {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			select {
+			case <-drained:
+			default:
+				status.Drained = false
+			}
+		}
+	}
+
+	c.drainLock.Lock()
+	defer c.drainLock.Unlock()
+	if !status.Drained {
+		status.InFlight = slices.Sorted(maps.Keys(c.inFlight))
+	}
+	status.Pending = slices.Clone(c.pending)
+	slices.Sort(status.Pending)
+	return status
+}
+
+func (s *sharedController) drain(ctx context.Context) (backend.DrainStatus, bool) {
+	s.startLock.Lock()
+	c, ok := s.controller.(drainController)
+	s.startLock.Unlock()
+
+	if !ok {
+		return backend.DrainStatus{}, false
+	}
+	return c.Drain(ctx), true
+}
+
+func (s *sharedControllerFactory) Drain(ctx context.Context, gvks ...schema.GroupVersionKind) []backend.DrainStatus {
+	s.controllerLock.RLock()
+	var controllers []*sharedController
+	if len(gvks) == 0 {
+		controllers = slices.Collect(maps.Values(s.controllers))
+	}
+	for _, gvk := range gvks {
+		if controller, ok := s.controllers[gvk]; ok {
+			controllers = append(controllers, controller)
+		}
+	}
+	s.controllerLock.RUnlock()
+
+	// The controllers stop at the same time, so waiting for them in turn with the same ctx waits no longer than ctx
+	var result []backend.DrainStatus
+	for _, controller := range controllers {
+		if status, ok := controller.drain(ctx); ok {
+			result = append(result, status)
+		}
+	}
+	slices.SortFunc(result, func(a, b backend.DrainStatus) int {
+		return strings.Compare(a.GVK.String(), b.GVK.String())
+	})
+	return result
+}
+
+func (b *Backend) Drain(ctx context.Context, gvks ...schema.GroupVersionKind) []backend.DrainStatus {
+	return b.cacheFactory.Drain(ctx, gvks...)
+}
@@ -0,0 +1,160 @@
+package runtime
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// FairQueue configures a controller to dequeue keys fairly between tenants instead of first in, first out, so that
+// one tenant with many objects doesn't starve the others.
+type FairQueue struct {
+	// Tenant returns the tenant of a key. Defaults to the namespace of the key.
+	Tenant func(key string) string
+	// Weight returns the number of keys dequeued for the tenant in each round. Defaults to 1 for every tenant.
+	Weight func(tenant string) int
+}
+
+func (f *FairQueue) tenant(key string) string {
+	if f.Tenant != nil {
+		return f.Tenant(key)
+	}
+	// Triggers, replays, and scheduled keys count against the tenant of the object they are for
+	ns, _ := KeyParse(key)
+	return ns
+}
+
+func (f *FairQueue) weight(tenant string) int {
+	if f.Weight == nil {
+		return 1
+	}
+	if w := f.Weight(tenant); w > 0 {
+		return w
+	}
+	return 1
+}
+
+var (
+	fairQueues     sync.Map
+	tenantDepth, _ = meter.Int64ObservableGauge("nah.queue.tenant.depth",
+		metric.WithDescription("Number of keys waiting in a fair queue per tenant"))
+	_, _ = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		fairQueues.Range(func(key, _ any) bool {
+			q := key.(*fairQueue)
+			for tenant, depth := range q.depths() {
+				o.ObserveInt64(tenantDepth, int64(depth), metric.WithAttributes(
+					attribute.String("queue", q.name),
+					attribute.String("tenant", tenant)))
+			}
+			return true
+		})
+		return nil
+	}, tenantDepth)
+)
+
+// fairQueue is a workqueue.Queue that keeps a queue per tenant and takes weighted turns between the tenants.
+// The workqueue calls it while holding its own lock, the lock here only protects the depths reported as metrics.
+type fairQueue struct {
+	name   string
+	config *FairQueue
+
+	lock    sync.Mutex
+	tenants map[string][]any
+	// ring is the order the tenants with queued keys take turns in
+	ring []string
+	// next is the index in ring of the tenant whose turn it is
+	next int
+	// credit is the number of keys left in the turn of the current tenant
+	credit int
+	length int
+}
+
+func newFairQueue(name string, config *FairQueue) *fairQueue {
+	q := &fairQueue{
+		name:    name,
+		config:  config,
+		tenants: map[string][]any{},
+	}
+	fairQueues.Store(q, struct{}{})
+	return q
+}
+
+// close stops reporting the metrics of the queue.
+func (q *fairQueue) close() {
+	fairQueues.Delete(q)
+}
+
+func (q *fairQueue) Touch(any) {}
+
+func (q *fairQueue) Push(item any) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var tenant string
+	if key, ok := queueKey(item); ok {
+		tenant = q.config.tenant(key)
+	}
+	if len(q.tenants[tenant]) == 0 {
+		q.ring = append(q.ring, tenant)
+	}
+	q.tenants[tenant] = append(q.tenants[tenant], item)
+	q.length++
+}
+
+func (q *fairQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.length
+}
+
+func (q *fairQueue) Pop() any {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.length == 0 {
+		return nil
+	}
+
+	if q.next >= len(q.ring) {
+		q.next = 0
+		q.credit = 0
+	}
+	tenant := q.ring[q.next]
+	if q.credit <= 0 {
+		q.credit = q.config.weight(tenant)
+	}
+
+	items := q.tenants[tenant]
+	item := items[0]
+	items[0] = nil
+	items = items[1:]
+	q.length--
+	q.credit--
+
+	if len(items) == 0 {
+		// The tenant leaves the ring until it has keys again, the next tenant moves into its place
+		delete(q.tenants, tenant)
+		q.ring = append(q.ring[:q.next], q.ring[q.next+1:]...)
+		q.credit = 0
+		return item
+	}
+
+	q.tenants[tenant] = items
+	if q.credit <= 0 {
+		q.next++
+	}
+	return item
+}
+
+func (q *fairQueue) depths() map[string]int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	result := make(map[string]int, len(q.tenants))
+	for tenant, items := range q.tenants {
+		result[tenant] = len(items)
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func popAllFair(q *fairQueue) []any {
+	var result []any
+	for q.Len() > 0 {
+		result = append(result, q.Pop())
+	}
+	return result
+}
+
+func TestFairQueue(t *testing.T) {
+	q := newFairQueue("test", &FairQueue{})
+	defer q.close()
+
+	for _, key := range []string{"a/1", "a/2", "a/3", "b/1", "c/1"} {
+		q.Push(key)
+	}
+	assert.Equal(t, 5, q.Len())
+	assert.Equal(t, map[string]int{"a": 3, "b": 1, "c": 1}, q.depths())
+
+	assert.Equal(t, []any{"a/1", "b/1", "c/1", "a/2", "a/3"}, popAllFair(q))
+	assert.Empty(t, q.depths())
+	assert.Nil(t, q.Pop())
+}
+
+func TestFairQueueWeight(t *testing.T) {
+	q := newFairQueue("test", &FairQueue{
+		Weight: func(tenant string) int {
+			if tenant == "a" {
+				return 2
+			}
+			return 0
+		},
+	})
+	defer q.close()
+
+	for _, key := range []string{"a/1", "a/2", "a/3", "a/4", "b/1", "b/2"} {
+		q.Push(key)
+	}
+	assert.Equal(t, []any{"a/1", "a/2", "b/1", "a/3", "a/4", "b/2"}, popAllFair(q))
+}
+
+func TestFairQueueTenantRejoins(t *testing.T) {
+	q := newFairQueue("test", &FairQueue{})
+	defer q.close()
+
+	q.Push("a/1")
+	q.Push("b/1")
+	q.Push("b/2")
+	assert.Equal(t, "a/1", q.Pop())
+	// a left the ring and rejoins behind b
+	q.Push("a/2")
+	assert.Equal(t, []any{"b/1", "a/2", "b/2"}, popAllFair(q))
+}
+
+func TestFairQueueLaneItems(t *testing.T) {
+	q := newFairQueue("test", &FairQueue{})
+	defer q.close()
+
+	q.Push(laneItem{item: "a/1", gen: 1})
+	q.Push(laneItem{item: "a/2", gen: 2})
+	q.Push(laneItem{item: "b/1", gen: 3})
+	assert.Equal(t, map[string]int{"a": 2, "b": 1}, q.depths())
+}
+
+func TestFairQueueTenant(t *testing.T) {
+	f := &FairQueue{}
+	assert.Equal(t, "a", f.tenant("a/b"))
+	assert.Equal(t, "a", f.tenant("_t _s a/b"))
+	assert.Equal(t, "", f.tenant("b"))
+
+	f.Tenant = func(key string) string {
+		tenant, _, _ := strings.Cut(key, "-")
+		return tenant
+	}
+	assert.Equal(t, "x", f.tenant("x-1"))
+}
@@ -0,0 +1,253 @@
+package runtime
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// lane is the priority class of a key in the workqueue. Lower lanes have higher priority.
+type lane int
+
+const (
+	// laneChange is for keys enqueued by watch events
+	laneChange lane = iota
+	// laneTrigger is for keys enqueued by triggers and explicit enqueues
+	laneTrigger
+	// laneRetry is for keys requeued after an error and for periodic resyncs
+	laneRetry
+
+	laneCount
+)
+
+func (l lane) String() string {
+	switch l {
+	case laneChange:
+		return "change"
+	case laneTrigger:
+		return "trigger"
+	case laneRetry:
+		return "retry"
+	}
+	return fmt.Sprintf("lane-%d", int(l))
+}
+
+// PriorityLanes configures the weights of the priority lanes of a controller's workqueues. In each round up to the
+// weight of keys is dequeued from each lane, starting with the highest priority lane, so higher priority keys
+// are preferred without starving the others.
+type PriorityLanes struct {
+	// Changes is the weight of keys enqueued by watch events. Defaults to 8.
+	Changes int `json:"changes,omitempty"`
+	// Triggers is the weight of keys enqueued by triggers and Enqueue. Defaults to 4.
+	Triggers int `json:"triggers,omitempty"`
+	// Retries is the weight of keys requeued after an error and of periodic resyncs. Defaults to 1.
+	Retries int `json:"retries,omitempty"`
+}
+
+func (p *PriorityLanes) weights() [laneCount]int {
+	result := [laneCount]int{8, 4, 1}
+	if p == nil {
+		return result
+	}
+	for l, w := range [laneCount]int{p.Changes, p.Triggers, p.Retries} {
+		if w > 0 {
+			result[l] = w
+		}
+	}
+	return result
+}
+
+// laneItem is an item in the queue of a lane. An item can be in a lower lane and a higher lane at the same time
+// when it is promoted, the generation identifies which of the two is current.
+type laneItem struct {
+	item any
+	gen  uint64
+}
+
+type laneEntry struct {
+	lane lane
+	gen  uint64
+}
+
+// queueKey returns the key of an item of a lane queue.
+func queueKey(item any) (string, bool) {
+	if li, ok := item.(laneItem); ok {
+		item = li.item
+	}
+	key, ok := item.(string)
+	return key, ok
+}
+
+// laneKey is an item added to the workqueue with its lane. The lane stays with the item while it waits in the
+// delaying queue, so items added for the same key in the meantime don't change it.
+type laneKey struct {
+	item any
+	lane lane
+}
+
+// laneMarker is the workqueue under the delaying queue. It marks the lane of a laneKey right before its item is
+// added, which consumes the mark in Push or Touch, or in Push when the item is done if it is being processed.
+type laneMarker struct {
+	workqueue.TypedInterface[any]
+	lanes *laneQueue
+}
+
+func (m *laneMarker) Add(item any) {
+	lk, ok := item.(laneKey)
+	if !ok {
+		m.TypedInterface.Add(item)
+		return
+	}
+
+	m.lanes.mark(lk.item, lk.lane)
+	m.TypedInterface.Add(lk.item)
+	if m.ShuttingDown() {
+		// The item was dropped, so the mark would never be consumed
+		m.lanes.unmark(lk.item)
+	}
+}
+
+// laneQueue is a workqueue.Queue that keeps a queue per lane and dequeues from them by weighted round-robin. The
+// lane of an item is set with mark right before it is added to the workqueue, items that aren't marked are changes.
+// Items are added as a laneKey, see laneMarker, so that delayed items keep their lane.
+type laneQueue struct {
+	weights [laneCount]int
+
+	lock    sync.Mutex
+	lanes   [laneCount]workqueue.Queue[any]
+	entries map[any]laneEntry
+	marks   map[any]lane
+	gen     uint64
+	length  int
+	// current is the lane being dequeued from and credit is the number of keys left in its turn
+	current lane
+	credit  int
+}
+
+func newLaneQueue(weights [laneCount]int, newQueue func(lane) workqueue.Queue[any]) *laneQueue {
+	q := &laneQueue{
+		weights: weights,
+		entries: map[any]laneEntry{},
+		marks:   map[any]lane{},
+		current: laneCount - 1,
+	}
+	for l := range q.lanes {
+		q.lanes[l] = newQueue(lane(l))
+	}
+	return q
+}
+
+// mark sets the lane of the item for the next time it is added to the workqueue. If the item is already queued
+// in a lower priority lane it is promoted. An item keeps the highest priority it was marked with.
+func (q *laneQueue) mark(item any, l lane) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if existing, ok := q.marks[item]; !ok || l < existing {
+		q.marks[item] = l
+	}
+}
+
+func (q *laneQueue) unmark(item any) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	delete(q.marks, item)
+}
+
+func (q *laneQueue) takeMark(item any) (lane, bool) {
+	l, ok := q.marks[item]
+	delete(q.marks, item)
+	return l, ok
+}
+
+func (q *laneQueue) pushLocked(item any, l lane) {
+	q.gen++
+	q.entries[item] = laneEntry{lane: l, gen: q.gen}
+	q.lanes[l].Push(laneItem{item: item, gen: q.gen})
+}
+
+func (q *laneQueue) Touch(item any) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	l, ok := q.takeMark(item)
+	if !ok {
+		return
+	}
+	if entry, ok := q.entries[item]; ok && l < entry.lane {
+		// The copy in the lower lane is skipped when it is popped
+		q.pushLocked(item, l)
+	}
+}
+
+func (q *laneQueue) Push(item any) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	l, _ := q.takeMark(item)
+	q.pushLocked(item, l)
+	q.length++
+}
+
+func (q *laneQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.length
+}
+
+func (q *laneQueue) Pop() any {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for q.length > 0 {
+		l := q.nextLane()
+		li := q.lanes[l].Pop().(laneItem)
+		if entry, ok := q.entries[li.item]; !ok || entry.gen != li.gen {
+			// This item was promoted to a higher lane
+			continue
+		}
+		delete(q.entries, li.item)
+		q.length--
+		q.credit--
+		return li.item
+	}
+	return nil
+}
+
+// nextLane returns the lane to dequeue from. There must be at least one item queued.
+func (q *laneQueue) nextLane() lane {
+	for {
+		if q.credit > 0 && q.lanes[q.current].Len() > 0 {
+			return q.current
+		}
+		q.current = (q.current + 1) % laneCount
+		q.credit = q.weights[q.current]
+	}
+}
+
+// newRateLimitingQueue returns a workqueue with priority lanes. If fair is set, the keys in each lane are dequeued
+// fairly between tenants and the fair queues are returned so that they can be closed when the workqueue is shut down.
+func newRateLimitingQueue(name string, rateLimiter workqueue.TypedRateLimiter[any], priorityLanes *PriorityLanes, fair *FairQueue) (workqueue.TypedRateLimitingInterface[any], *laneQueue, []*fairQueue) {
+	var fairQueues []*fairQueue
+	lanes := newLaneQueue(priorityLanes.weights(), func(l lane) workqueue.Queue[any] {
+		if fair == nil {
+			return workqueue.DefaultQueue[any]()
+		}
+		q := newFairQueue(fmt.Sprintf("%s-%s", name, l), fair)
+		fairQueues = append(fairQueues, q)
+		return q
+	})
+	return workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter, workqueue.TypedRateLimitingQueueConfig[any]{
+		Name: name,
+		DelayingQueue: workqueue.NewTypedDelayingQueueWithConfig(workqueue.TypedDelayingQueueConfig[any]{
+			Name: name,
+			Queue: &laneMarker{
+				TypedInterface: workqueue.NewTypedWithConfig(workqueue.TypedQueueConfig[any]{
+					Name:  name,
+					Queue: lanes,
+				}),
+				lanes: lanes,
+			},
+		}),
+	}), lanes, fairQueues
+}
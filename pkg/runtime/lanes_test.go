@@ -0,0 +1,166 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func newTestLaneQueue(weights [laneCount]int) *laneQueue {
+	return newLaneQueue(weights, func(lane) workqueue.Queue[any] {
+		return workqueue.DefaultQueue[any]()
+	})
+}
+
+func pushLane(q *laneQueue, item string, l lane) {
+	q.mark(item, l)
+	q.Push(item)
+}
+
+func popAll(q *laneQueue) []any {
+	var result []any
+	for q.Len() > 0 {
+		result = append(result, q.Pop())
+	}
+	return result
+}
+
+func TestLaneQueueWeights(t *testing.T) {
+	q := newTestLaneQueue([laneCount]int{2, 1, 1})
+	for _, item := range []string{"c1", "c2", "c3", "c4"} {
+		pushLane(q, item, laneChange)
+	}
+	pushLane(q, "t1", laneTrigger)
+	pushLane(q, "t2", laneTrigger)
+	pushLane(q, "r1", laneRetry)
+
+	assert.Equal(t, 7, q.Len())
+	assert.Equal(t, []any{"c1", "c2", "t1", "r1", "c3", "c4", "t2"}, popAll(q))
+	assert.Nil(t, q.Pop())
+}
+
+func TestLaneQueueUnmarkedIsChange(t *testing.T) {
+	q := newTestLaneQueue([laneCount]int{1, 1, 1})
+	pushLane(q, "r1", laneRetry)
+	pushLane(q, "t1", laneTrigger)
+	q.Push("c1")
+
+	assert.Equal(t, []any{"c1", "t1", "r1"}, popAll(q))
+}
+
+func TestLaneQueuePromotion(t *testing.T) {
+	q := newTestLaneQueue([laneCount]int{1, 1, 1})
+	pushLane(q, "a", laneRetry)
+	pushLane(q, "b", laneRetry)
+	pushLane(q, "c", laneRetry)
+
+	// Touching an item that isn't marked keeps its lane
+	q.Touch("a")
+	// b is promoted, the copy in the retry lane is skipped
+	q.mark("b", laneChange)
+	q.Touch("b")
+	// A lower priority mark doesn't demote
+	q.mark("c", laneTrigger)
+	q.mark("c", laneRetry)
+	q.Touch("c")
+
+	assert.Equal(t, 3, q.Len())
+	assert.Equal(t, []any{"b", "c", "a"}, popAll(q))
+	assert.Empty(t, q.entries)
+	assert.Empty(t, q.marks)
+}
+
+func newTestRateLimitingQueue() (workqueue.TypedRateLimitingInterface[any], *laneQueue) {
+	queue, lanes, _ := newRateLimitingQueue("test", workqueue.DefaultTypedControllerRateLimiter[any](), nil, nil)
+	return queue, lanes
+}
+
+func getAll(t *testing.T, queue workqueue.TypedRateLimitingInterface[any]) []any {
+	t.Helper()
+
+	var result []any
+	for queue.Len() > 0 {
+		item, shutdown := queue.Get()
+		require.False(t, shutdown)
+		queue.Done(item)
+		result = append(result, item)
+	}
+	return result
+}
+
+func TestRateLimitingQueueLanes(t *testing.T) {
+	queue, _ := newTestRateLimitingQueue()
+	defer queue.ShutDown()
+
+	queue.Add(laneKey{item: "r1", lane: laneRetry})
+	queue.Add(laneKey{item: "t1", lane: laneTrigger})
+	queue.Add(laneKey{item: "c1", lane: laneChange})
+	queue.Add("c2")
+
+	assert.Equal(t, []any{"c1", "c2", "t1", "r1"}, getAll(t, queue))
+}
+
+func TestRateLimitingQueuePromotion(t *testing.T) {
+	queue, lanes := newTestRateLimitingQueue()
+	defer queue.ShutDown()
+
+	queue.Add(laneKey{item: "r1", lane: laneRetry})
+	queue.Add(laneKey{item: "r2", lane: laneRetry})
+	queue.Add(laneKey{item: "r2", lane: laneChange})
+
+	assert.Equal(t, 2, queue.Len())
+	assert.Equal(t, []any{"r2", "r1"}, getAll(t, queue))
+	assert.Empty(t, lanes.marks)
+}
+
+func TestRateLimitingQueueDelayedKeepsLane(t *testing.T) {
+	queue, lanes := newTestRateLimitingQueue()
+	defer queue.ShutDown()
+
+	queue.AddAfter(laneKey{item: "a", lane: laneRetry}, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return queue.Len() == 1
+	}, 5*time.Second, time.Millisecond)
+
+	lanes.lock.Lock()
+	defer lanes.lock.Unlock()
+	assert.Equal(t, laneRetry, lanes.entries["a"].lane)
+	assert.Empty(t, lanes.marks)
+}
+
+func TestRateLimitingQueueAddWhileProcessing(t *testing.T) {
+	queue, lanes := newTestRateLimitingQueue()
+	defer queue.ShutDown()
+
+	queue.Add(laneKey{item: "a", lane: laneChange})
+	item, _ := queue.Get()
+	require.Equal(t, "a", item)
+
+	// The lane is kept until the item is done and added again
+	queue.Add(laneKey{item: "a", lane: laneRetry})
+	assert.Equal(t, 0, queue.Len())
+	assert.Equal(t, laneRetry, lanes.marks["a"])
+
+	queue.Done(item)
+	assert.Equal(t, 1, queue.Len())
+	assert.Equal(t, laneRetry, lanes.entries["a"].lane)
+	assert.Empty(t, lanes.marks)
+}
+
+func TestRateLimitingQueueAddAfterShutDown(t *testing.T) {
+	queue, lanes := newTestRateLimitingQueue()
+	queue.ShutDown()
+
+	queue.Add(laneKey{item: "a", lane: laneTrigger})
+	assert.Equal(t, 0, queue.Len())
+	assert.Empty(t, lanes.marks)
+}
+
+func TestPriorityLanesWeights(t *testing.T) {
+	var p *PriorityLanes
+	assert.Equal(t, [laneCount]int{8, 4, 1}, p.weights())
+	assert.Equal(t, [laneCount]int{8, 2, 1}, (&PriorityLanes{Triggers: 2, Retries: -1}).weights())
+}
@@ -0,0 +1,623 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/obot-platform/nah/pkg/log"
+	"github.com/obot-platform/nah/pkg/merr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	kcache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+var namespaceGVK = schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}
+
+// namespaceSelectorCache is a cache.Cache that caches namespaced objects only in the namespaces that match a
+// label selector. A cache is added for each namespace when it starts matching and removed when it stops
+// matching. The informers returned for namespaced types combine the informers of all the namespace caches.
+type namespaceSelectorCache struct {
+	rest     *rest.Config
+	opts     cache.Options
+	selector labels.Selector
+	// allowed is the set of namespaces that can be selected, all namespaces if empty
+	allowed map[string]bool
+	cluster cache.Cache
+
+	lock         sync.RWMutex
+	ctx          context.Context
+	registration kcache.ResourceEventHandlerRegistration
+	namespaces   map[string]*namespaceCache
+	informers    map[informerKey]*multiInformer
+	indexes      []fieldIndex
+}
+
+type namespaceCache struct {
+	cache.Cache
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type informerKey struct {
+	gvk          schema.GroupVersionKind
+	metadataOnly bool
+}
+
+type fieldIndex struct {
+	obj     kclient.Object
+	field   string
+	extract kclient.IndexerFunc
+}
+
+func newNamespaceSelectorCache(cfg *rest.Config, opts cache.Options, selector labels.Selector, allowed []string) (*namespaceSelectorCache, error) {
+	cluster, err := cache.New(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &namespaceSelectorCache{
+		rest:       cfg,
+		opts:       opts,
+		selector:   selector,
+		allowed:    map[string]bool{},
+		cluster:    cluster,
+		namespaces: map[string]*namespaceCache{},
+		informers:  map[informerKey]*multiInformer{},
+	}
+	for _, ns := range allowed {
+		c.allowed[ns] = true
+	}
+
+	// Each namespace cache only watches its own namespace
+	c.opts.DefaultNamespaces = nil
+	c.opts.ByObject = make(map[kclient.Object]cache.ByObject, len(opts.ByObject))
+	for obj, byObject := range opts.ByObject {
+		byObject.Namespaces = nil
+		c.opts.ByObject[obj] = byObject
+	}
+
+	return c, nil
+}
+
+func (c *namespaceSelectorCache) namespaced(obj runtime.Object) (informerKey, bool, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.opts.Scheme)
+	if err != nil {
+		return informerKey{}, false, err
+	}
+	if _, ok := obj.(kclient.ObjectList); ok {
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
+
+	_, partial := obj.(*metav1.PartialObjectMetadata)
+	_, partialList := obj.(*metav1.PartialObjectMetadataList)
+	key := informerKey{gvk: gvk, metadataOnly: partial || partialList}
+
+	nsed, err := apiutil.IsGVKNamespaced(gvk, c.opts.Mapper)
+	return key, nsed, err
+}
+
+func (c *namespaceSelectorCache) namespaceCache(namespace string) *namespaceCache {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.namespaces[namespace]
+}
+
+// namespaceSelected returns true if objects of the namespace are cached. Cluster scoped objects are always cached.
+func (c *namespaceSelectorCache) namespaceSelected(namespace string) bool {
+	return namespace == "" || c.namespaceCache(namespace) != nil
+}
+
+func (c *namespaceSelectorCache) namespaceCaches() []*namespaceCache {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	result := make([]*namespaceCache, 0, len(c.namespaces))
+	for _, nc := range c.namespaces {
+		result = append(result, nc)
+	}
+	return result
+}
+
+func (c *namespaceSelectorCache) Get(ctx context.Context, key kclient.ObjectKey, obj kclient.Object, opts ...kclient.GetOption) error {
+	k, nsed, err := c.namespaced(obj)
+	if err != nil {
+		return err
+	} else if !nsed {
+		return c.cluster.Get(ctx, key, obj, opts...)
+	}
+
+	nc := c.namespaceCache(key.Namespace)
+	if nc == nil {
+		return errNamespaceNotCached(k.gvk.Kind, key.Namespace, key.Name)
+	}
+	return nc.Get(ctx, key, obj, opts...)
+}
+
+func (c *namespaceSelectorCache) List(ctx context.Context, list kclient.ObjectList, opts ...kclient.ListOption) error {
+	_, nsed, err := c.namespaced(list)
+	if err != nil {
+		return err
+	} else if !nsed {
+		return c.cluster.List(ctx, list, opts...)
+	}
+
+	listOpts := (&kclient.ListOptions{}).ApplyOptions(opts)
+	if listOpts.Namespace != "" {
+		nc := c.namespaceCache(listOpts.Namespace)
+		if nc == nil {
+			return meta.SetList(list, nil)
+		}
+		return nc.List(ctx, list, opts...)
+	}
+
+	var items []runtime.Object
+	for _, nc := range c.namespaceCaches() {
+		nsList := list.DeepCopyObject().(kclient.ObjectList)
+		if err := nc.List(ctx, nsList, opts...); err != nil {
+			return err
+		}
+		nsItems, err := meta.ExtractList(nsList)
+		if err != nil {
+			return err
+		}
+		items = append(items, nsItems...)
+	}
+	return meta.SetList(list, items)
+}
+
+func (c *namespaceSelectorCache) GetInformer(ctx context.Context, obj kclient.Object, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	key, nsed, err := c.namespaced(obj)
+	if err != nil {
+		return nil, err
+	} else if !nsed {
+		return c.cluster.GetInformer(ctx, obj, opts...)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if mi := c.informers[key]; mi != nil {
+		return mi, nil
+	}
+
+	mi := &multiInformer{
+		parent: c,
+		obj:    obj.DeepCopyObject().(kclient.Object),
+		subs:   map[string]cache.Informer{},
+	}
+	for ns, nc := range c.namespaces {
+		informer, err := nc.GetInformer(nc.ctx, mi.obj.DeepCopyObject().(kclient.Object), opts...)
+		if err != nil {
+			return nil, err
+		}
+		if err := mi.addNamespace(ns, informer); err != nil {
+			return nil, err
+		}
+	}
+	c.informers[key] = mi
+	return mi, nil
+}
+
+func (c *namespaceSelectorCache) GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	obj, err := c.opts.Scheme.New(gvk)
+	if runtime.IsNotRegisteredError(err) {
+		ustr := &unstructured.Unstructured{}
+		ustr.SetGroupVersionKind(gvk)
+		obj = ustr
+	} else if err != nil {
+		return nil, err
+	}
+	return c.GetInformer(ctx, obj.(kclient.Object), opts...)
+}
+
+func (c *namespaceSelectorCache) RemoveInformer(ctx context.Context, obj kclient.Object) error {
+	key, nsed, err := c.namespaced(obj)
+	if err != nil {
+		return err
+	} else if !nsed {
+		return c.cluster.RemoveInformer(ctx, obj)
+	}
+
+	c.lock.Lock()
+	delete(c.informers, key)
+	c.lock.Unlock()
+
+	var errs []error
+	for _, nc := range c.namespaceCaches() {
+		if err := nc.RemoveInformer(ctx, obj); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return merr.NewErrors(errs...)
+}
+
+func (c *namespaceSelectorCache) IndexField(ctx context.Context, obj kclient.Object, field string, extractValue kclient.IndexerFunc) error {
+	_, nsed, err := c.namespaced(obj)
+	if err != nil {
+		return err
+	} else if !nsed {
+		return c.cluster.IndexField(ctx, obj, field, extractValue)
+	}
+
+	c.lock.Lock()
+	c.indexes = append(c.indexes, fieldIndex{obj: obj, field: field, extract: extractValue})
+	c.lock.Unlock()
+
+	for _, nc := range c.namespaceCaches() {
+		if err := nc.IndexField(nc.ctx, obj, field, extractValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start watches the namespaces and runs the cluster scoped cache until the context is closed. It blocks.
+func (c *namespaceSelectorCache) Start(ctx context.Context) error {
+	c.lock.Lock()
+	if c.ctx != nil {
+		c.lock.Unlock()
+		return errors.New("namespace selector cache already started")
+	}
+	c.ctx = ctx
+	c.lock.Unlock()
+
+	namespaces := &metav1.PartialObjectMetadata{}
+	namespaces.SetGroupVersionKind(namespaceGVK)
+	informer, err := c.cluster.GetInformer(ctx, namespaces)
+	if err != nil {
+		return err
+	}
+
+	registration, err := informer.AddEventHandler(kcache.ResourceEventHandlerFuncs{
+		AddFunc: c.onNamespace,
+		UpdateFunc: func(_, obj any) {
+			c.onNamespace(obj)
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(kcache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, err := meta.Accessor(obj); err == nil {
+				c.removeNamespace(ns.GetName())
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.registration = registration
+	c.lock.Unlock()
+
+	return c.cluster.Start(ctx)
+}
+
+func (c *namespaceSelectorCache) WaitForCacheSync(ctx context.Context) bool {
+	for {
+		c.lock.RLock()
+		registration := c.registration
+		c.lock.RUnlock()
+		if registration != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	if !c.cluster.WaitForCacheSync(ctx) {
+		return false
+	}
+	c.lock.RLock()
+	registration := c.registration
+	c.lock.RUnlock()
+	if !kcache.WaitForCacheSync(ctx.Done(), registration.HasSynced) {
+		return false
+	}
+
+	for _, nc := range c.namespaceCaches() {
+		if !nc.WaitForCacheSync(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *namespaceSelectorCache) selects(ns metav1.Object) bool {
+	if len(c.allowed) > 0 && !c.allowed[ns.GetName()] {
+		return false
+	}
+	return c.selector.Matches(labels.Set(ns.GetLabels()))
+}
+
+func (c *namespaceSelectorCache) onNamespace(obj any) {
+	ns, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	if !ns.GetDeletionTimestamp().IsZero() || !c.selects(ns) {
+		c.removeNamespace(ns.GetName())
+		return
+	}
+	if err := c.addNamespace(ns.GetName()); err != nil {
+		log.Errorf("failed to add cache for namespace %s: %v", ns.GetName(), err)
+	}
+}
+
+func (c *namespaceSelectorCache) addNamespace(namespace string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.namespaces[namespace] != nil {
+		return nil
+	}
+
+	opts := c.opts
+	opts.DefaultNamespaces = map[string]cache.Config{namespace: {}}
+	nc, err := cache.New(c.rest, opts)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	for _, index := range c.indexes {
+		if err := nc.IndexField(ctx, index.obj, index.field, index.extract); err != nil {
+			cancel()
+			return err
+		}
+	}
+	for _, mi := range c.informers {
+		informer, err := nc.GetInformer(ctx, mi.obj.DeepCopyObject().(kclient.Object))
+		if err != nil {
+			cancel()
+			return err
+		}
+		if err := mi.addNamespace(namespace, informer); err != nil {
+			cancel()
+			return err
+		}
+	}
+
+	log.Infof("Adding cache for namespace %s", namespace)
+	c.namespaces[namespace] = &namespaceCache{
+		Cache:  nc,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go func() {
+		if err := nc.Start(ctx); err != nil {
+			log.Errorf("cache for namespace %s stopped: %v", namespace, err)
+		}
+	}()
+	return nil
+}
+
+func (c *namespaceSelectorCache) removeNamespace(namespace string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	nc := c.namespaces[namespace]
+	if nc == nil {
+		return
+	}
+
+	log.Infof("Removing cache for namespace %s", namespace)
+	delete(c.namespaces, namespace)
+	for _, mi := range c.informers {
+		mi.removeNamespace(namespace)
+	}
+	nc.cancel()
+}
+
+// multiInformer combines the informers of a type in each namespace cache. Handlers and indexers are added to
+// the informers of namespaces that are added later. When a namespace is removed its informer is stopped, handlers
+// don't see its objects deleted because they still exist.
+type multiInformer struct {
+	parent *namespaceSelectorCache
+	obj    kclient.Object
+
+	lock          sync.Mutex
+	subs          map[string]cache.Informer
+	registrations []*multiRegistration
+	indexers      kcache.Indexers
+}
+
+type multiRegistration struct {
+	handler kcache.ResourceEventHandler
+	resync  time.Duration
+
+	lock sync.Mutex
+	subs map[string]kcache.ResourceEventHandlerRegistration
+}
+
+func (r *multiRegistration) HasSynced() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, sub := range r.subs {
+		if !sub.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *multiRegistration) add(namespace string, informer cache.Informer) error {
+	var (
+		sub kcache.ResourceEventHandlerRegistration
+		err error
+	)
+	if r.resync > 0 {
+		sub, err = informer.AddEventHandlerWithResyncPeriod(r.handler, r.resync)
+	} else {
+		sub, err = informer.AddEventHandler(r.handler)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	r.subs[namespace] = sub
+	r.lock.Unlock()
+	return nil
+}
+
+func (m *multiInformer) addNamespace(namespace string, informer cache.Informer) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.indexers) > 0 {
+		if err := informer.AddIndexers(m.indexers); err != nil {
+			return err
+		}
+	}
+	for _, r := range m.registrations {
+		if err := r.add(namespace, informer); err != nil {
+			return err
+		}
+	}
+	m.subs[namespace] = informer
+	return nil
+}
+
+func (m *multiInformer) removeNamespace(namespace string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	informer := m.subs[namespace]
+	if informer == nil {
+		return
+	}
+	delete(m.subs, namespace)
+
+	for _, r := range m.registrations {
+		r.lock.Lock()
+		sub := r.subs[namespace]
+		delete(r.subs, namespace)
+		r.lock.Unlock()
+
+		if sub != nil {
+			_ = informer.RemoveEventHandler(sub)
+		}
+	}
+}
+
+func (m *multiInformer) AddEventHandler(handler kcache.ResourceEventHandler) (kcache.ResourceEventHandlerRegistration, error) {
+	return m.AddEventHandlerWithResyncPeriod(handler, 0)
+}
+
+func (m *multiInformer) AddEventHandlerWithResyncPeriod(handler kcache.ResourceEventHandler, resyncPeriod time.Duration) (kcache.ResourceEventHandlerRegistration, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	r := &multiRegistration{
+		handler: handler,
+		resync:  resyncPeriod,
+		subs:    map[string]kcache.ResourceEventHandlerRegistration{},
+	}
+	for namespace, informer := range m.subs {
+		if err := r.add(namespace, informer); err != nil {
+			return nil, err
+		}
+	}
+	m.registrations = append(m.registrations, r)
+	return r, nil
+}
+
+func (m *multiInformer) RemoveEventHandler(handle kcache.ResourceEventHandlerRegistration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, r := range m.registrations {
+		if r != handle {
+			continue
+		}
+		m.registrations = append(m.registrations[:i], m.registrations[i+1:]...)
+
+		var errs []error
+		r.lock.Lock()
+		for namespace, sub := range r.subs {
+			if informer := m.subs[namespace]; informer != nil {
+				if err := informer.RemoveEventHandler(sub); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		r.subs = map[string]kcache.ResourceEventHandlerRegistration{}
+		r.lock.Unlock()
+		return merr.NewErrors(errs...)
+	}
+	return nil
+}
+
+func (m *multiInformer) AddIndexers(indexers kcache.Indexers) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, informer := range m.subs {
+		if err := informer.AddIndexers(indexers); err != nil {
+			return err
+		}
+	}
+	if m.indexers == nil {
+		m.indexers = kcache.Indexers{}
+	}
+	for k, v := range indexers {
+		m.indexers[k] = v
+	}
+	return nil
+}
+
+func (m *multiInformer) HasSynced() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, informer := range m.subs {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// LastSyncResourceVersion returns the oldest resourceVersion seen by the informers of the namespaces, or an empty
+// string if any of them doesn't know. The resourceVersions of all namespaces come from the same etcd revision, and the
+// informer of each namespace has seen every change of its namespace up to its own resourceVersion. Once the oldest of
+// them has reached a resourceVersion, every namespace has seen the changes up to it, so comparing it with the
+// resourceVersion of a write is safe. A namespace without recent changes holds the result back, which only makes
+// reads wait for the cache or go to the API server.
+func (m *multiInformer) LastSyncResourceVersion() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var result string
+	for _, informer := range m.subs {
+		versioned, ok := informer.(resourceVersioned)
+		if !ok {
+			return ""
+		}
+		rv := versioned.LastSyncResourceVersion()
+		if rv == "" {
+			return ""
+		}
+		if result == "" || newer(rv, result) {
+			result = rv
+		}
+	}
+	return result
+}
+
+func (m *multiInformer) IsStopped() bool {
+	return false
+}
@@ -0,0 +1,249 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/obot-platform/nah/pkg/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kcache "k8s.io/client-go/tools/cache"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+var (
+	_ kcache.SharedIndexInformer = (*multiInformer)(nil)
+	_ kcache.Indexer             = (*multiStore)(nil)
+
+	errReadOnlyStore = errors.New("the store of a namespace selector cache is read only")
+)
+
+func (m *multiInformer) GetStore() kcache.Store {
+	return m.GetIndexer()
+}
+
+// GetIndexer returns a read only indexer that reads from the caches of the namespaces. Indexes are evaluated by
+// listing the objects, which is slower than the indexes of a single informer.
+func (m *multiInformer) GetIndexer() kcache.Indexer {
+	return &multiStore{informer: m}
+}
+
+func (m *multiInformer) GetController() kcache.Controller {
+	return m
+}
+
+// Run blocks until stopCh is closed. The informers of the namespaces are run by their caches.
+func (m *multiInformer) Run(stopCh <-chan struct{}) {
+	<-stopCh
+}
+
+func (m *multiInformer) SetWatchErrorHandler(kcache.WatchErrorHandler) error {
+	return errors.New("the watch error handler of a namespace selector cache is set by its options")
+}
+
+func (m *multiInformer) SetTransform(kcache.TransformFunc) error {
+	return errors.New("the transform of a namespace selector cache is set by its options")
+}
+
+// multiStore is a read only kcache.Indexer over the caches of the namespaces of a multiInformer.
+type multiStore struct {
+	informer *multiInformer
+}
+
+func (s *multiStore) Add(any) error {
+	return errReadOnlyStore
+}
+
+func (s *multiStore) Update(any) error {
+	return errReadOnlyStore
+}
+
+func (s *multiStore) Delete(any) error {
+	return errReadOnlyStore
+}
+
+func (s *multiStore) Replace([]any, string) error {
+	return errReadOnlyStore
+}
+
+func (s *multiStore) Resync() error {
+	return nil
+}
+
+func (s *multiStore) AddIndexers(kcache.Indexers) error {
+	return errors.New("add indexers to the informer instead of its store")
+}
+
+func (s *multiStore) newList() (kclient.ObjectList, error) {
+	obj := s.informer.obj
+	gvk, err := apiutil.GVKForObject(obj, s.informer.parent.opts.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	gvk.Kind += "List"
+
+	switch obj.(type) {
+	case *metav1.PartialObjectMetadata:
+		list := &metav1.PartialObjectMetadataList{}
+		list.SetGroupVersionKind(gvk)
+		return list, nil
+	case *unstructured.Unstructured:
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk)
+		return list, nil
+	}
+	list, err := s.informer.parent.opts.Scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return list.(kclient.ObjectList), nil
+}
+
+func (s *multiStore) List() []any {
+	var result []any
+	for _, nc := range s.informer.parent.namespaceCaches() {
+		list, err := s.newList()
+		if err != nil {
+			log.Errorf("failed to list %T from namespace cache: %v", s.informer.obj, err)
+			return nil
+		}
+		if err := nc.List(context.TODO(), list); err != nil {
+			log.Errorf("failed to list %T from namespace cache: %v", s.informer.obj, err)
+			continue
+		}
+		_ = meta.EachListItem(list, func(obj runtime.Object) error {
+			result = append(result, obj)
+			return nil
+		})
+	}
+	return result
+}
+
+func (s *multiStore) ListKeys() []string {
+	return keys(s.List())
+}
+
+func (s *multiStore) Get(obj any) (any, bool, error) {
+	key, err := kcache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	return s.GetByKey(key)
+}
+
+func (s *multiStore) GetByKey(key string) (any, bool, error) {
+	ns, name, err := kcache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	nc := s.informer.parent.namespaceCache(ns)
+	if nc == nil {
+		return nil, false, nil
+	}
+
+	obj := s.informer.obj.DeepCopyObject().(kclient.Object)
+	if err := nc.Get(context.TODO(), kclient.ObjectKey{Namespace: ns, Name: name}, obj); apierrors.IsNotFound(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return obj, true, nil
+}
+
+func (s *multiStore) GetIndexers() kcache.Indexers {
+	s.informer.lock.Lock()
+	defer s.informer.lock.Unlock()
+	result := make(kcache.Indexers, len(s.informer.indexers))
+	for k, v := range s.informer.indexers {
+		result[k] = v
+	}
+	return result
+}
+
+func (s *multiStore) indexFunc(indexName string) (kcache.IndexFunc, error) {
+	f := s.GetIndexers()[indexName]
+	if f == nil {
+		return nil, fmt.Errorf("index with name %s does not exist", indexName)
+	}
+	return f, nil
+}
+
+// filter returns the objects with any of the values in the index.
+func (s *multiStore) filter(indexName string, values sets.Set[string]) ([]any, error) {
+	f, err := s.indexFunc(indexName)
+	if err != nil {
+		return nil, err
+	}
+	var result []any
+	for _, obj := range s.List() {
+		objValues, err := f(obj)
+		if err != nil {
+			return nil, err
+		}
+		if values.HasAny(objValues...) {
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
+func (s *multiStore) Index(indexName string, obj any) ([]any, error) {
+	f, err := s.indexFunc(indexName)
+	if err != nil {
+		return nil, err
+	}
+	values, err := f(obj)
+	if err != nil {
+		return nil, err
+	}
+	return s.filter(indexName, sets.New(values...))
+}
+
+func (s *multiStore) ByIndex(indexName, indexedValue string) ([]any, error) {
+	return s.filter(indexName, sets.New(indexedValue))
+}
+
+func (s *multiStore) IndexKeys(indexName, indexedValue string) ([]string, error) {
+	objs, err := s.ByIndex(indexName, indexedValue)
+	if err != nil {
+		return nil, err
+	}
+	return keys(objs), nil
+}
+
+func (s *multiStore) ListIndexFuncValues(indexName string) []string {
+	f, err := s.indexFunc(indexName)
+	if err != nil {
+		return nil
+	}
+	values := sets.New[string]()
+	for _, obj := range s.List() {
+		if objValues, err := f(obj); err == nil {
+			values.Insert(objValues...)
+		}
+	}
+	return sets.List(values)
+}
+
+func keys(objs []any) []string {
+	result := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		if key, err := kcache.MetaNamespaceKeyFunc(obj); err == nil {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// errNamespaceNotCached is returned for reads in namespaces that are not selected. It is not a NotFound error
+// because the object may exist.
+func errNamespaceNotCached(kind, namespace, name string) error {
+	return fmt.Errorf("unable to get %s %s/%s: namespace %s is not selected by the cache", strings.ToLower(kind), namespace, name, namespace)
+}
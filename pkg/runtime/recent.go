@@ -0,0 +1,220 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+
+	nahfields "github.com/obot-platform/nah/pkg/fields"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+var (
+	meter = otel.Meter("nah/runtime")
+
+	recentHits, _ = meter.Int64Counter("nah.cache.recent.hits",
+		metric.WithDescription("Reads from the cache that were changed by a recent write the cache had not seen yet"))
+	recentMisses, _ = meter.Int64Counter("nah.cache.recent.misses",
+		metric.WithDescription("Reads from the cache that checked a recent write the cache had already seen"))
+)
+
+func recordRecent(ctx context.Context, op string, gvk schema.GroupVersionKind, hit bool) {
+	attrs := metric.WithAttributes(attribute.String("op", op), attribute.String("gvk", gvk.String()))
+	if hit {
+		recentHits.Add(ctx, 1, attrs)
+	} else {
+		recentMisses.Add(ctx, 1, attrs)
+	}
+}
+
+// recentFor returns the recent writes of the GVK in the namespace. An empty namespace returns all namespaces.
+func (c *cacheClient) recentFor(gvk schema.GroupVersionKind, namespace string) map[string]objectValue {
+	c.recentLock.Lock()
+	defer c.recentLock.Unlock()
+
+	var result map[string]objectValue
+	for k, v := range c.recent {
+		if k.gvk != gvk || namespace != "" && k.namespace != namespace {
+			continue
+		}
+		if result == nil {
+			result = map[string]objectValue{}
+		}
+		result[k.namespace+"/"+k.name] = v
+	}
+	return result
+}
+
+// mergeRecent adds the creates, updates, and deletes made through this client that the cache has not seen yet
+// to the list, so that a List after a write sees the write the same as Get does. Lists with a limit or continue
+// token are not merged, so that a page never has more items than the limit. Lists with a field selector are only
+// merged if the selector can be evaluated on all the recent objects, see fieldSet.
+func (c *cacheClient) mergeRecent(ctx context.Context, list kclient.ObjectList, opts ...kclient.ListOption) error {
+	gvk, err := apiutil.GVKForObject(list, c.Scheme())
+	if err != nil {
+		return nil
+	}
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+
+	listOpts := (&kclient.ListOptions{}).ApplyOptions(opts)
+	if listOpts.Limit > 0 || listOpts.Continue != "" {
+		return nil
+	}
+	recent := c.recentFor(gvk, listOpts.Namespace)
+	if len(recent) == 0 {
+		return nil
+	}
+	if listOpts.FieldSelector != nil && !listOpts.FieldSelector.Empty() {
+		for _, value := range recent {
+			if !canMatchFields(value.Object, listOpts.FieldSelector) {
+				return nil
+			}
+		}
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	var (
+		changed bool
+		result  = make([]runtime.Object, 0, len(items))
+	)
+
+	for _, item := range items {
+		obj, ok := item.(kclient.Object)
+		if !ok {
+			result = append(result, item)
+			continue
+		}
+
+		key := obj.GetNamespace() + "/" + obj.GetName()
+		value, ok := recent[key]
+		if !ok {
+			result = append(result, item)
+			continue
+		}
+		delete(recent, key)
+
+		switch {
+		case value.Deleted && len(obj.GetFinalizers()) == 0 && !newer(value.Object.GetResourceVersion(), obj.GetResourceVersion()):
+			// The cache has not seen the delete yet
+			changed = true
+			recordRecent(ctx, "list", gvk, true)
+		case !value.Deleted && newer(obj.GetResourceVersion(), value.Object.GetResourceVersion()):
+			changed = true
+			recordRecent(ctx, "list", gvk, true)
+			if !matches(value.Object, listOpts) {
+				continue
+			}
+			newItem, err := c.toListItem(list, item, value.Object)
+			if err != nil {
+				return err
+			}
+			result = append(result, newItem)
+		default:
+			recordRecent(ctx, "list", gvk, false)
+			result = append(result, item)
+		}
+	}
+
+	// Whatever is left was not in the cache
+	for _, value := range recent {
+		if value.Deleted || !matches(value.Object, listOpts) {
+			continue
+		}
+		newItem, err := c.toListItem(list, nil, value.Object)
+		if err != nil {
+			return err
+		}
+		result = append(result, newItem)
+		changed = true
+		recordRecent(ctx, "list", gvk, true)
+	}
+
+	if !changed {
+		return nil
+	}
+	return meta.SetList(list, result)
+}
+
+// matches returns true if the object matches the label and field selectors of the list options.
+func matches(obj kclient.Object, opts *kclient.ListOptions) bool {
+	if opts.LabelSelector != nil && !opts.LabelSelector.Matches(labels.Set(obj.GetLabels())) {
+		return false
+	}
+	return opts.FieldSelector == nil || opts.FieldSelector.Matches(fieldSet(obj))
+}
+
+// fieldSet returns the fields of the object that a field selector can be evaluated on: metadata.name,
+// metadata.namespace, and the fields of objects that implement fields.Fields.
+func fieldSet(obj kclient.Object) fields.Set {
+	set := fields.Set{
+		"metadata.name":      obj.GetName(),
+		"metadata.namespace": obj.GetNamespace(),
+	}
+	if f, ok := obj.(nahfields.Fields); ok {
+		for _, name := range f.FieldNames() {
+			set[name] = f.Get(name)
+		}
+	}
+	return set
+}
+
+// canMatchFields returns true if every field of the selector is in the field set of the object.
+func canMatchFields(obj kclient.Object, selector fields.Selector) bool {
+	set := fieldSet(obj)
+	for _, req := range selector.Requirements() {
+		if !set.Has(req.Field) {
+			return false
+		}
+	}
+	return true
+}
+
+// toListItem converts the recent object to the type of the items of the list. The existing item, if any, is used
+// as the prototype.
+func (c *cacheClient) toListItem(list kclient.ObjectList, existing runtime.Object, obj kclient.Object) (runtime.Object, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return nil, err
+	}
+
+	var newItem runtime.Object
+	switch list.(type) {
+	case *unstructured.UnstructuredList:
+		data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		u := &unstructured.Unstructured{Object: data}
+		u.SetGroupVersionKind(gvk)
+		return u, nil
+	case *metav1.PartialObjectMetadataList:
+		newItem = &metav1.PartialObjectMetadata{}
+	default:
+		if existing != nil {
+			newItem = existing.DeepCopyObject()
+		} else if newItem, err = c.Scheme().New(gvk); err != nil {
+			return nil, err
+		}
+	}
+	if err := CopyInto(newItem, obj); err != nil {
+		return nil, err
+	}
+	if partial, ok := newItem.(*metav1.PartialObjectMetadata); ok {
+		partial.SetGroupVersionKind(gvk)
+	}
+	return newItem, nil
+}
@@ -0,0 +1,158 @@
+package runtime
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func configMap(name, resourceVersion, value string, labels map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			ResourceVersion: resourceVersion,
+			Labels:          labels,
+		},
+		Data: map[string]string{"value": value},
+	}
+}
+
+// newTestCacheClient returns a cache client whose cache has the objects.
+func newTestCacheClient(t *testing.T, objs ...kclient.Object) *cacheClient {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	cached := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithIndex(&corev1.ConfigMap{}, "metadata.name", func(obj kclient.Object) []string {
+			return []string{obj.GetName()}
+		}).
+		WithIndex(&corev1.ConfigMap{}, "custom", func(kclient.Object) []string {
+			return nil
+		}).
+		Build()
+	return newCacheClient(nil, cached, nil, Config{})
+}
+
+// listValues lists the config maps and returns the value of each by name.
+func listValues(t *testing.T, c *cacheClient, opts ...kclient.ListOption) map[string]string {
+	t.Helper()
+
+	list := &corev1.ConfigMapList{}
+	require.NoError(t, c.List(context.Background(), list, opts...))
+	result := map[string]string{}
+	for _, item := range list.Items {
+		result[item.Name] = item.Data["value"]
+	}
+	return result
+}
+
+func TestMergeRecent(t *testing.T) {
+	tests := []struct {
+		name    string
+		cached  []kclient.Object
+		created []kclient.Object
+		deleted []kclient.Object
+		opts    []kclient.ListOption
+		want    map[string]string
+	}{
+		{
+			name:    "create not in the cache",
+			cached:  []kclient.Object{configMap("a", "1", "a1", nil)},
+			created: []kclient.Object{configMap("b", "2", "b2", nil)},
+			want:    map[string]string{"a": "a1", "b": "b2"},
+		},
+		{
+			name:    "update newer than the cache",
+			cached:  []kclient.Object{configMap("a", "1", "a1", nil)},
+			created: []kclient.Object{configMap("a", "2", "a2", nil)},
+			want:    map[string]string{"a": "a2"},
+		},
+		{
+			name:    "update older than the cache",
+			cached:  []kclient.Object{configMap("a", "10", "a10", nil)},
+			created: []kclient.Object{configMap("a", "9", "a9", nil)},
+			want:    map[string]string{"a": "a10"},
+		},
+		{
+			name:    "delete not seen by the cache",
+			cached:  []kclient.Object{configMap("a", "1", "a1", nil), configMap("b", "1", "b1", nil)},
+			deleted: []kclient.Object{configMap("a", "1", "a1", nil)},
+			want:    map[string]string{"b": "b1"},
+		},
+		{
+			name:   "label selector",
+			cached: []kclient.Object{configMap("a", "1", "a1", map[string]string{"app": "x"})},
+			created: []kclient.Object{
+				configMap("a", "2", "a2", map[string]string{"app": "y"}),
+				configMap("b", "2", "b2", map[string]string{"app": "x"}),
+				configMap("c", "2", "c2", map[string]string{"app": "y"}),
+			},
+			opts: []kclient.ListOption{kclient.MatchingLabelsSelector{Selector: labels.SelectorFromSet(labels.Set{"app": "x"})}},
+			want: map[string]string{"b": "b2"},
+		},
+		{
+			name:    "field selector on the name",
+			cached:  []kclient.Object{configMap("a", "1", "a1", nil)},
+			created: []kclient.Object{configMap("b", "2", "b2", nil), configMap("c", "2", "c2", nil)},
+			opts:    []kclient.ListOption{kclient.MatchingFieldsSelector{Selector: fields.OneTermEqualSelector("metadata.name", "b")}},
+			want:    map[string]string{"b": "b2"},
+		},
+		{
+			name:    "field selector that can't be evaluated",
+			cached:  []kclient.Object{configMap("a", "1", "a1", nil)},
+			created: []kclient.Object{configMap("b", "2", "b2", nil)},
+			opts:    []kclient.ListOption{kclient.MatchingFieldsSelector{Selector: fields.OneTermEqualSelector("custom", "b")}},
+			want:    map[string]string{},
+		},
+		{
+			name:    "limit",
+			cached:  []kclient.Object{configMap("a", "1", "a1", nil)},
+			created: []kclient.Object{configMap("b", "2", "b2", nil)},
+			opts:    []kclient.ListOption{kclient.Limit(1)},
+			want:    map[string]string{"a": "a1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCacheClient(t, tt.cached...)
+			for _, obj := range tt.created {
+				c.store(obj)
+			}
+			for _, obj := range tt.deleted {
+				c.deleteStore(obj)
+			}
+			assert.Equal(t, tt.want, listValues(t, c, tt.opts...))
+		})
+	}
+}
+
+func TestMergeRecentOtherNamespace(t *testing.T) {
+	c := newTestCacheClient(t, configMap("a", "1", "a1", nil))
+	other := configMap("b", "2", "b2", nil)
+	other.Namespace = "other"
+	c.store(other)
+
+	assert.Equal(t, map[string]string{"a": "a1"}, listValues(t, c, kclient.InNamespace("default")))
+
+	names := make([]string, 0, 2)
+	for name := range listValues(t, c) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"a", "b"}, names)
+}
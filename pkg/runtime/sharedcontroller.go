@@ -5,9 +5,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/obot-platform/nah/pkg/backend"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -41,6 +43,7 @@ type sharedController struct {
 	startError         error
 	client             kclient.Client
 	gvk                schema.GroupVersionKind
+	metadataOnly       bool
 }
 
 func (s *sharedController) Cache() (cache.Cache, error) {
@@ -67,7 +70,8 @@ func (s *sharedController) initController() Controller {
 	s.startLock.Lock()
 	defer s.startLock.Unlock()
 
-	if s.controller != nil {
+	// Retry if the type was not known, it may have been installed since.
+	if s.controller != nil && !meta.IsNoMatchError(s.startError) {
 		return s.controller
 	}
 
@@ -113,6 +117,43 @@ func (s *sharedController) Start(ctx context.Context, workers int) error {
 	return nil
 }
 
+// deadLetterController is implemented by controllers that park keys that keep failing.
+type deadLetterController interface {
+	ParkedKeys() []backend.ParkedKey
+	ReleaseParked(key string) bool
+}
+
+// parkedKeys returns the parked keys of the controller, if it has been created.
+func (s *sharedController) parkedKeys() []backend.ParkedKey {
+	s.startLock.Lock()
+	defer s.startLock.Unlock()
+
+	if c, ok := s.controller.(deadLetterController); ok {
+		return c.ParkedKeys()
+	}
+	return nil
+}
+
+func (s *sharedController) releaseParked(key string) bool {
+	s.startLock.Lock()
+	defer s.startLock.Unlock()
+
+	if c, ok := s.controller.(deadLetterController); ok {
+		return c.ReleaseParked(key)
+	}
+	return false
+}
+
+func (s *sharedController) stop() {
+	s.startLock.Lock()
+	defer s.startLock.Unlock()
+
+	if c, ok := s.controller.(interface{ Stop() }); ok {
+		c.Stop()
+	}
+	s.started = false
+}
+
 func (s *sharedController) RegisterHandler(ctx context.Context, name string, handler SharedControllerHandler) (returnErr error) {
 	// Ensure that controller is initialized
 	c := s.initController()
@@ -137,11 +178,19 @@ func (s *sharedController) RegisterHandler(ctx context.Context, name string, han
 				cache   cache.Cache
 			)
 
-			objList, returnErr = s.client.Scheme().New(schema.GroupVersionKind{
-				Group:   s.gvk.Group,
-				Version: s.gvk.Version,
-				Kind:    s.gvk.Kind + "List",
-			})
+			if s.metadataOnly {
+				objList = &metav1.PartialObjectMetadataList{}
+				objList.GetObjectKind().SetGroupVersionKind(s.gvk.GroupVersion().WithKind(s.gvk.Kind + "List"))
+			} else {
+				objList, returnErr = s.client.Scheme().New(schema.GroupVersionKind{
+					Group:   s.gvk.Group,
+					Version: s.gvk.Version,
+					Kind:    s.gvk.Kind + "List",
+				})
+				if returnErr != nil {
+					return
+				}
+			}
 			cache, returnErr = s.controller.Cache()
 			if returnErr != nil {
 				return
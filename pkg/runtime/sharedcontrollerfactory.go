@@ -3,8 +3,10 @@ package runtime
 import (
 	"context"
 	"maps"
+	"slices"
 	"sync"
 
+	"github.com/obot-platform/nah/pkg/backend"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -13,6 +15,24 @@ import (
 
 type SharedControllerFactory interface {
 	ForKind(ctx context.Context, gvk schema.GroupVersionKind) (SharedController, error)
+	// RemoveKind stops the controller of the GVK and removes its informer from the cache, even if cached reads of
+	// the client use it. A new controller is created the next time ForKind is called.
+	RemoveKind(ctx context.Context, gvk schema.GroupVersionKind) error
+	// ParkedKeys returns the keys of all the controllers that are not retried because they failed too many times.
+	ParkedKeys() []backend.ParkedKey
+	// ReleaseParked enqueues the parked key of the GVK again. It returns false if the key was not parked.
+	ReleaseParked(gvk schema.GroupVersionKind, key string) bool
+	// PausedGVKs returns the GVKs whose controllers are paused.
+	PausedGVKs() []schema.GroupVersionKind
+	// Drain waits for the controllers of the GVKs, or all controllers if none are given, to stop after the context
+	// they were started with is done, until ctx is done.
+	Drain(ctx context.Context, gvks ...schema.GroupVersionKind) []backend.DrainStatus
+	// SetPaused records if the controller of the GVK is paused, so that it is created paused if it is removed
+	// and created again. It does not pause or resume the current controller.
+	SetPaused(gvk schema.GroupVersionKind, paused bool)
+	// SetMetadataOnly records that only the metadata of the GVK is watched, if its controller has not been created
+	// yet. It returns true if only the metadata of the GVK is watched.
+	SetMetadataOnly(gvk schema.GroupVersionKind) bool
 	Preload(ctx context.Context) error
 	Start(ctx context.Context) error
 }
@@ -24,6 +44,11 @@ type SharedControllerFactoryOptions struct {
 	KindRateLimiter   map[schema.GroupVersionKind]workqueue.TypedRateLimiter[any]
 	KindWorkers       map[schema.GroupVersionKind]int
 	KindQueueSplitter map[schema.GroupVersionKind]WorkerQueueSplitter
+	KindMetadataOnly  map[schema.GroupVersionKind]bool
+	KindFairQueue     map[schema.GroupVersionKind]*FairQueue
+	KindPriorityLanes map[schema.GroupVersionKind]*PriorityLanes
+	KindDeadLetter    map[schema.GroupVersionKind]*DeadLetter
+	KindPaused        map[schema.GroupVersionKind]bool
 }
 
 type sharedControllerFactory struct {
@@ -40,6 +65,12 @@ type sharedControllerFactory struct {
 	kindRateLimiter   map[schema.GroupVersionKind]workqueue.TypedRateLimiter[any]
 	kindWorkers       map[schema.GroupVersionKind]int
 	kindQueueSplitter map[schema.GroupVersionKind]WorkerQueueSplitter
+	kindFairQueue     map[schema.GroupVersionKind]*FairQueue
+	kindPriorityLanes map[schema.GroupVersionKind]*PriorityLanes
+	kindDeadLetter    map[schema.GroupVersionKind]*DeadLetter
+	// kindPaused and kindMetadataOnly are guarded by the controllerLock
+	kindPaused       map[schema.GroupVersionKind]bool
+	kindMetadataOnly map[schema.GroupVersionKind]bool
 }
 
 func NewSharedControllerFactory(c kclient.Client, cache cache.Cache, opts *SharedControllerFactoryOptions) SharedControllerFactory {
@@ -53,6 +84,11 @@ func NewSharedControllerFactory(c kclient.Client, cache cache.Cache, opts *Share
 		rateLimiter:       opts.DefaultRateLimiter,
 		kindRateLimiter:   opts.KindRateLimiter,
 		kindQueueSplitter: opts.KindQueueSplitter,
+		kindFairQueue:     opts.KindFairQueue,
+		kindPriorityLanes: opts.KindPriorityLanes,
+		kindDeadLetter:    opts.KindDeadLetter,
+		kindPaused:        maps.Clone(opts.KindPaused),
+		kindMetadataOnly:  maps.Clone(opts.KindMetadataOnly),
 	}
 }
 
@@ -64,6 +100,9 @@ func applyDefaultSharedOptions(opts *SharedControllerFactoryOptions) *SharedCont
 	if newOpts.DefaultWorkers == 0 {
 		newOpts.DefaultWorkers = DefaultThreadiness
 	}
+	if newOpts.KindPaused == nil {
+		newOpts.KindPaused = map[schema.GroupVersionKind]bool{}
+	}
 	return &newOpts
 }
 func (s *sharedControllerFactory) Preload(ctx context.Context) error {
@@ -141,6 +180,8 @@ func (s *sharedControllerFactory) ForKind(ctx context.Context, gvk schema.GroupV
 	}
 
 	handler := &SharedHandler{gvk: gvk}
+	paused := s.kindPaused[gvk]
+	metadataOnly := s.kindMetadataOnly[gvk]
 
 	controllerResult = &sharedController{
 		deferredController: func() (Controller, error) {
@@ -152,17 +193,96 @@ func (s *sharedControllerFactory) ForKind(ctx context.Context, gvk schema.GroupV
 			return New(ctx, gvk, s.client.Scheme(), s.cache, handler, &Options{
 				RateLimiter:   rateLimiter,
 				QueueSplitter: s.kindQueueSplitter[gvk],
+				MetadataOnly:  metadataOnly,
+				FairQueue:     s.kindFairQueue[gvk],
+				PriorityLanes: s.kindPriorityLanes[gvk],
+				DeadLetter:    s.kindDeadLetter[gvk],
+				Client:        s.client,
+				Paused:        paused,
 			})
 		},
-		handler: handler,
-		client:  s.client,
-		gvk:     gvk,
+		handler:      handler,
+		client:       s.client,
+		gvk:          gvk,
+		metadataOnly: metadataOnly,
 	}
 
 	s.controllers[gvk] = controllerResult
 	return controllerResult, nil
 }
 
+func (s *sharedControllerFactory) ParkedKeys() []backend.ParkedKey {
+	s.controllerLock.RLock()
+	controllers := make([]*sharedController, 0, len(s.controllers))
+	for _, controller := range s.controllers {
+		controllers = append(controllers, controller)
+	}
+	s.controllerLock.RUnlock()
+
+	var result []backend.ParkedKey
+	for _, controller := range controllers {
+		result = append(result, controller.parkedKeys()...)
+	}
+	return result
+}
+
+func (s *sharedControllerFactory) PausedGVKs() []schema.GroupVersionKind {
+	s.controllerLock.RLock()
+	defer s.controllerLock.RUnlock()
+
+	return slices.Collect(maps.Keys(s.kindPaused))
+}
+
+func (s *sharedControllerFactory) SetPaused(gvk schema.GroupVersionKind, paused bool) {
+	s.controllerLock.Lock()
+	defer s.controllerLock.Unlock()
+	if paused {
+		s.kindPaused[gvk] = true
+	} else {
+		delete(s.kindPaused, gvk)
+	}
+}
+
+func (s *sharedControllerFactory) SetMetadataOnly(gvk schema.GroupVersionKind) bool {
+	s.controllerLock.Lock()
+	defer s.controllerLock.Unlock()
+	if s.controllers[gvk] == nil {
+		if s.kindMetadataOnly == nil {
+			s.kindMetadataOnly = map[schema.GroupVersionKind]bool{}
+		}
+		s.kindMetadataOnly[gvk] = true
+	}
+	return s.kindMetadataOnly[gvk]
+}
+
+func (s *sharedControllerFactory) ReleaseParked(gvk schema.GroupVersionKind, key string) bool {
+	controller := s.byGVK(gvk)
+	if controller == nil {
+		return false
+	}
+	return controller.releaseParked(key)
+}
+
+func (s *sharedControllerFactory) RemoveKind(ctx context.Context, gvk schema.GroupVersionKind) error {
+	s.controllerLock.Lock()
+	controller := s.controllers[gvk]
+	delete(s.controllers, gvk)
+	metadataOnly := s.kindMetadataOnly[gvk]
+	s.controllerLock.Unlock()
+
+	if controller == nil {
+		return nil
+	}
+	controller.stop()
+
+	obj, err := newObject(s.client.Scheme(), gvk, metadataOnly)
+	if err != nil {
+		return err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	return s.cache.RemoveInformer(ctx, obj.(kclient.Object))
+}
+
 func (s *sharedControllerFactory) getWorkers(gvk schema.GroupVersionKind) (int, error) {
 	if w, ok := s.kindWorkers[gvk]; ok {
 		return w, nil
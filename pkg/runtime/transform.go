@@ -0,0 +1,102 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/obot-platform/nah/pkg/apply"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	kcache "k8s.io/client-go/tools/cache"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// StripTransform returns a cache transform that drops the managedFields of objects if stripManagedFields is set. If
+// stripApplied is set, the applied annotation written by apply is replaced with apply.AppliedAnnotationStripped and
+// apply reads the object from the API server when it needs the annotation. Updates through the client restore the
+// annotation and patches that would write the placeholder are rejected, so the placeholder never reaches the API
+// server.
+func StripTransform(stripManagedFields, stripApplied bool) kcache.TransformFunc {
+	return func(in any) (any, error) {
+		obj, err := meta.Accessor(in)
+		if err != nil {
+			return in, nil
+		}
+		// Nil check to avoid hitting https://github.com/kubernetes/kubernetes/issues/124337
+		if stripManagedFields && obj.GetManagedFields() != nil {
+			obj.SetManagedFields(nil)
+		}
+		if stripApplied {
+			if annotations := obj.GetAnnotations(); annotations[apply.LabelApplied] != "" {
+				annotations[apply.LabelApplied] = apply.AppliedAnnotationStripped
+				obj.SetAnnotations(annotations)
+			}
+		}
+		return in, nil
+	}
+}
+
+// strippedPatch is how the placeholder of the applied annotation appears in a patch.
+var strippedPatch = []byte(fmt.Sprintf("%q:%q", apply.LabelApplied, apply.AppliedAnnotationStripped))
+
+// restoreApplied replaces the placeholder of the applied annotation, which objects read from the cache have, with
+// the value on the API server so that the update doesn't overwrite the annotation.
+func (c *cacheClient) restoreApplied(ctx context.Context, obj kclient.Object) error {
+	annotations := obj.GetAnnotations()
+	if annotations[apply.LabelApplied] != apply.AppliedAnnotationStripped {
+		return nil
+	}
+
+	live := obj.DeepCopyObject().(kclient.Object)
+	if err := c.uncached.Get(ctx, kclient.ObjectKeyFromObject(obj), live); err != nil {
+		return err
+	}
+	if applied, ok := live.GetAnnotations()[apply.LabelApplied]; ok {
+		annotations[apply.LabelApplied] = applied
+	} else {
+		delete(annotations, apply.LabelApplied)
+	}
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// checkStrippedPatch returns an error if the patch would write the placeholder of the applied annotation.
+func checkStrippedPatch(obj kclient.Object, patch kclient.Patch) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(data, strippedPatch) {
+		return fmt.Errorf("patch of %s would overwrite the %s annotation with the placeholder of the cache, read the object with untriggered.UncachedGet first",
+			kclient.ObjectKeyFromObject(obj), apply.LabelApplied)
+	}
+	return nil
+}
+
+// cacheTransform returns the transform for all objects in the cache, which calls the transform of the GVK of the
+// object or the default transform.
+func cacheTransform(cfg Config, scheme *runtime.Scheme) kcache.TransformFunc {
+	defaultTransform := cfg.DefaultTransform
+	if defaultTransform == nil && (cfg.StripManagedFields || cfg.StripAppliedAnnotation) {
+		defaultTransform = StripTransform(cfg.StripManagedFields, cfg.StripAppliedAnnotation)
+	}
+	if len(cfg.GVKTransforms) == 0 {
+		return defaultTransform
+	}
+
+	return func(in any) (any, error) {
+		if obj, ok := in.(runtime.Object); ok {
+			if gvk, err := apiutil.GVKForObject(obj, scheme); err == nil {
+				if transform, ok := cfg.GVKTransforms[gvk]; ok {
+					return transform(in)
+				}
+			}
+		}
+		if defaultTransform == nil {
+			return in, nil
+		}
+		return defaultTransform(in)
+	}
+}
@@ -7,30 +7,42 @@ import (
 
 type Holder struct {
 	kclient.Object
-	uncached bool
+	uncached           bool
+	minResourceVersion string
 }
 
 func (h *Holder) DeepCopyObject() runtime.Object {
-	return &Holder{Object: h.Object.DeepCopyObject().(kclient.Object), uncached: h.uncached}
+	return &Holder{Object: h.Object.DeepCopyObject().(kclient.Object), uncached: h.uncached, minResourceVersion: h.minResourceVersion}
 }
 
 func (h *Holder) IsUncached() bool {
 	return h.uncached
 }
 
+// MinResourceVersion is the resourceVersion the cache must have seen before it is read.
+func (h *Holder) MinResourceVersion() string {
+	return h.minResourceVersion
+}
+
 type HolderList struct {
 	kclient.ObjectList
-	uncached bool
+	uncached           bool
+	minResourceVersion string
 }
 
 func (h *HolderList) DeepCopyObject() runtime.Object {
-	return &HolderList{ObjectList: h.ObjectList.DeepCopyObject().(kclient.ObjectList), uncached: h.uncached}
+	return &HolderList{ObjectList: h.ObjectList.DeepCopyObject().(kclient.ObjectList), uncached: h.uncached, minResourceVersion: h.minResourceVersion}
 }
 
 func (h *HolderList) IsUncached() bool {
 	return h.uncached
 }
 
+// MinResourceVersion is the resourceVersion the cache must have seen before it is read.
+func (h *HolderList) MinResourceVersion() string {
+	return h.minResourceVersion
+}
+
 func List(obj kclient.ObjectList) kclient.ObjectList {
 	return &HolderList{
 		ObjectList: obj,
@@ -44,6 +56,16 @@ func UncachedList(obj kclient.ObjectList) kclient.ObjectList {
 	}
 }
 
+// ListAtLeast lists from the cache once it has seen at least the resourceVersion. If the cache doesn't catch up
+// shortly, or can't tell which resourceVersion it has seen, the list is read from the API server instead. Like the
+// other wrappers, the list doesn't register a trigger for the handler that reads it.
+func ListAtLeast(obj kclient.ObjectList, resourceVersion string) kclient.ObjectList {
+	return &HolderList{
+		ObjectList:         obj,
+		minResourceVersion: resourceVersion,
+	}
+}
+
 func Get(obj kclient.Object) kclient.Object {
 	return &Holder{
 		Object: obj,
@@ -57,6 +79,16 @@ func UncachedGet(obj kclient.Object) kclient.Object {
 	}
 }
 
+// GetAtLeast gets from the cache once it has seen at least the resourceVersion. If the cache doesn't catch up
+// shortly, or can't tell which resourceVersion it has seen, the object is read from the API server instead. Like
+// the other wrappers, the get doesn't register a trigger for the handler that reads it.
+func GetAtLeast(obj kclient.Object, resourceVersion string) kclient.Object {
+	return &Holder{
+		Object:             obj,
+		minResourceVersion: resourceVersion,
+	}
+}
+
 func IsWrapped(obj runtime.Object) bool {
 	if _, ok := obj.(*Holder); ok {
 		return true
@@ -77,6 +109,16 @@ func IsUncached(obj runtime.Object) bool {
 	return false
 }
 
+func MinResourceVersion(obj runtime.Object) string {
+	if h, ok := obj.(*Holder); ok {
+		return h.minResourceVersion
+	}
+	if h, ok := obj.(*HolderList); ok {
+		return h.minResourceVersion
+	}
+	return ""
+}
+
 func Unwrap(obj runtime.Object) runtime.Object {
 	if h, ok := obj.(*Holder); ok {
 		return h.Object
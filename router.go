@@ -2,6 +2,7 @@ package nah
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/obot-platform/nah/pkg/backend"
 	"github.com/obot-platform/nah/pkg/leader"
@@ -13,6 +14,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
+	kcache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -26,6 +29,13 @@ type Options struct {
 	RESTConfig *rest.Config
 	// If a Backend is provided, then this is ignored.
 	Namespace string
+	// Cache objects from these namespaces, in addition to Namespace.
+	// If a Backend is provided, then this is ignored.
+	Namespaces []string
+	// Only cache objects from namespaces with labels that match this selector. Namespaces are added and removed
+	// as their labels change. If Namespace or Namespaces are set, only those namespaces can be selected.
+	// If a Backend is provided, then this is ignored.
+	NamespaceSelector labels.Selector
 	// If a Backend is provided, then this is ignored.
 	LabelSelector labels.Selector
 	// If a Backend is provided, then this is ignored.
@@ -38,10 +48,70 @@ type Options struct {
 	ElectionConfig *leader.ElectionConfig
 	// Defaults to 8888
 	HealthzPort int
+	// Serve the admin endpoints on the healthz server, authenticated with this bearer token. See Router.EnableAdmin.
+	AdminToken string
+	// How long to wait for the keys being handled when the router stops, see Router.StopStatus. Defaults to
+	// router.DefaultDrainTimeout, a negative value waits until they are done. Handlers still running at the timeout
+	// are not stopped, see Router.DrainTimeout.
+	DrainTimeout time.Duration
+	// Tuning, usually loaded from a file or flags with LoadTuning or AddTuningFlags, overrides the controller
+	// tuning fields that it sets.
+	Tuning *Tuning
+	// The number of workers of each GVK. Defaults to 10, or the NAH_THREADINESS environment variable.
+	// If a Backend is provided, then this is ignored.
+	DefaultThreadiness int
+	// Delay the retries of keys that fail. Defaults to an exponential backoff from half a second to 15 minutes.
+	// If a Backend is provided, then this is ignored.
+	DefaultRateLimiter workqueue.TypedRateLimiter[any]
+	// Delay the retries of keys of these GVKs instead of DefaultRateLimiter.
+	GVKRateLimiters map[schema.GroupVersionKind]workqueue.TypedRateLimiter[any]
 	// Change the threadedness per GVK
 	GVKThreadiness map[schema.GroupVersionKind]int
 	// Split the worker queues for these GVKs
 	GVKQueueSplitters map[schema.GroupVersionKind]nruntime.WorkerQueueSplitter
+	// Dequeue the keys of these GVKs fairly between tenants, by default namespaces, instead of first in, first out.
+	// The depth of each tenant's queue is reported in the nah.queue.tenant.depth metric.
+	// If a Backend is provided, then this is ignored.
+	GVKFairQueues map[schema.GroupVersionKind]*nruntime.FairQueue
+	// Change the weights of the lanes keys are dequeued from per GVK. Watch events are dequeued before triggers,
+	// which are dequeued before retries and resyncs.
+	// If a Backend is provided, then this is ignored.
+	GVKPriorityLanes map[schema.GroupVersionKind]*nruntime.PriorityLanes
+	// Stop retrying keys of these GVKs after a maximum number of attempts. Parked keys are listed by
+	// Router.ParkedKeys and the /debug/parked endpoint of the healthz server.
+	// If a Backend is provided, then this is ignored.
+	GVKDeadLetters map[schema.GroupVersionKind]*nruntime.DeadLetter
+	// Start the handlers of these GVKs paused, for maintenance. Changes are held and handled when the GVK is
+	// resumed with Router.Resume. Individual objects are paused with the router.PausedAnnotation.
+	// If a Backend is provided, then this is ignored.
+	GVKPaused map[schema.GroupVersionKind]bool
+	// Watch and cache only the metadata of these GVKs. Handlers for these GVKs receive *metav1.PartialObjectMetadata.
+	// If a Backend is provided, then this is ignored.
+	GVKMetadataOnly map[schema.GroupVersionKind]bool
+	// Transform objects of these GVKs before they are stored in the cache, instead of DefaultTransform.
+	// If a Backend is provided, then this is ignored.
+	GVKTransforms map[schema.GroupVersionKind]kcache.TransformFunc
+	// Transform objects before they are stored in the cache. Defaults to the transform of StripManagedFields and
+	// StripAppliedAnnotation, if either is set.
+	// If a Backend is provided, then this is ignored.
+	DefaultTransform kcache.TransformFunc
+	// Drop the managedFields of cached objects.
+	// If a Backend is provided, then this is ignored.
+	StripManagedFields bool
+	// Replace the apply annotation of cached objects with a placeholder. Apply reads the objects it updates from the
+	// API server instead, and updates through the client restore the annotation.
+	// If a Backend is provided, then this is ignored.
+	StripAppliedAnnotation bool
+	// How long writes are merged into reads from the cache while the cache catches up. Lists with a limit or continue
+	// token, and lists with a field selector on other fields than metadata.name, metadata.namespace, or the fields
+	// of types that implement fields.Fields, are not merged. Defaults to 10 seconds, a negative value disables it.
+	// If a Backend is provided, then this is ignored.
+	RecentWritesWindow time.Duration
+	// How long reads that require a minimum resourceVersion, see untriggered.GetAtLeast, wait for the cache before
+	// they are read from the API server. Defaults to 2 seconds. With Namespace or Namespaces but no
+	// NamespaceSelector, these reads always go to the API server.
+	// If a Backend is provided, then this is ignored.
+	ConsistentReadWait time.Duration
 }
 
 func (o *Options) complete() (*Options, error) {
@@ -58,6 +128,17 @@ func (o *Options) complete() (*Options, error) {
 		result.HealthzPort = defaultHealthzPort
 	}
 
+	if err := result.Tuning.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid tuning: %w", err)
+	}
+	if result.Tuning != nil {
+		result.Tuning.apply(&result)
+	}
+	if err := result.validate(); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+	result.logTuning(result.Backend != nil)
+
 	if result.Backend != nil {
 		return &result, nil
 	}
@@ -71,13 +152,29 @@ func (o *Options) complete() (*Options, error) {
 	}
 
 	defaultConfig := nruntime.Config{
-		Rest:              result.RESTConfig,
-		Namespace:         result.Namespace,
-		LabelSelector:     result.LabelSelector,
-		FieldSelector:     result.FieldSelector,
-		ByObject:          result.ByObject,
-		GVKThreadiness:    result.GVKThreadiness,
-		GVKQueueSplitters: result.GVKQueueSplitters,
+		Rest:                   result.RESTConfig,
+		Namespace:              result.Namespace,
+		Namespaces:             result.Namespaces,
+		NamespaceSelector:      result.NamespaceSelector,
+		LabelSelector:          result.LabelSelector,
+		FieldSelector:          result.FieldSelector,
+		ByObject:               result.ByObject,
+		DefaultThreadiness:     result.DefaultThreadiness,
+		DefaultRateLimiter:     result.DefaultRateLimiter,
+		GVKRateLimiters:        result.GVKRateLimiters,
+		GVKThreadiness:         result.GVKThreadiness,
+		GVKQueueSplitters:      result.GVKQueueSplitters,
+		GVKFairQueues:          result.GVKFairQueues,
+		GVKPriorityLanes:       result.GVKPriorityLanes,
+		GVKDeadLetters:         result.GVKDeadLetters,
+		GVKPaused:              result.GVKPaused,
+		GVKMetadataOnly:        result.GVKMetadataOnly,
+		GVKTransforms:          result.GVKTransforms,
+		DefaultTransform:       result.DefaultTransform,
+		StripManagedFields:     result.StripManagedFields,
+		StripAppliedAnnotation: result.StripAppliedAnnotation,
+		RecentWritesWindow:     result.RecentWritesWindow,
+		ConsistentReadWait:     result.ConsistentReadWait,
 	}
 	backend, err := nruntime.NewRuntimeWithConfig(defaultConfig, result.Scheme)
 	if err != nil {
@@ -125,5 +222,12 @@ func NewRouter(handlerName string, opts *Options) (*router.Router, error) {
 	if err != nil {
 		return nil, err
 	}
-	return router.New(router.NewHandlerSet(handlerName, opts.Backend.Scheme(), opts.Backend), opts.ElectionConfig, opts.HealthzPort), nil
+	r := router.New(router.NewHandlerSet(handlerName, opts.Backend.Scheme(), opts.Backend), opts.ElectionConfig, opts.HealthzPort)
+	r.DrainTimeout = opts.DrainTimeout
+	if opts.AdminToken != "" {
+		if err := r.EnableAdmin(opts.AdminToken); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
 }
@@ -0,0 +1,410 @@
+package nah
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/obot-platform/nah/pkg/log"
+	"github.com/obot-platform/nah/pkg/router"
+	nruntime "github.com/obot-platform/nah/pkg/runtime"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/yaml"
+)
+
+// Tuning is the controller tuning of Options in a form that can be loaded from a YAML or JSON file, see LoadTuning,
+// or from flags, see AddTuningFlags. When it is set as Options.Tuning, the values it sets override the other fields
+// of Options.
+type Tuning struct {
+	// Threadiness is the number of workers of each GVK
+	Threadiness int `json:"threadiness,omitempty"`
+	// RateLimit is the backoff of keys that fail
+	RateLimit          *RateLimit       `json:"rateLimit,omitempty"`
+	DrainTimeout       *metav1.Duration `json:"drainTimeout,omitempty"`
+	RecentWritesWindow *metav1.Duration `json:"recentWritesWindow,omitempty"`
+	ConsistentReadWait *metav1.Duration `json:"consistentReadWait,omitempty"`
+	GVKs               []GVKTuning      `json:"gvks,omitempty"`
+}
+
+// RateLimit is an exponential backoff, from the base delay to the max delay, of keys that fail.
+type RateLimit struct {
+	BaseDelay metav1.Duration `json:"baseDelay"`
+	MaxDelay  metav1.Duration `json:"maxDelay"`
+}
+
+// GVKTuning is the tuning of the controller of one GVK.
+type GVKTuning struct {
+	APIVersion  string     `json:"apiVersion"`
+	Kind        string     `json:"kind"`
+	Threadiness int        `json:"threadiness,omitempty"`
+	RateLimit   *RateLimit `json:"rateLimit,omitempty"`
+	// Queues splits the keys between this number of workqueues by their hash
+	Queues int `json:"queues,omitempty"`
+	// FairQueue dequeues the keys fairly between namespaces
+	FairQueue     *FairQueueTuning        `json:"fairQueue,omitempty"`
+	PriorityLanes *nruntime.PriorityLanes `json:"priorityLanes,omitempty"`
+	DeadLetter    *nruntime.DeadLetter    `json:"deadLetter,omitempty"`
+	Paused        bool                    `json:"paused,omitempty"`
+}
+
+// FairQueueTuning is a fair queue between namespaces.
+type FairQueueTuning struct {
+	// Weights are the number of keys dequeued for each namespace in a round. Other namespaces have a weight of 1.
+	Weights map[string]int `json:"weights,omitempty"`
+}
+
+// LoadTuning reads and validates the tuning in the YAML or JSON file. Unknown fields are errors.
+func LoadTuning(path string) (*Tuning, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var t Tuning
+	if err := yaml.UnmarshalStrict(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse tuning %s: %w", path, err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid tuning %s: %w", path, err)
+	}
+	return &t, nil
+}
+
+// TuningFlags are the flags added by AddTuningFlags.
+type TuningFlags struct {
+	fs                 *flag.FlagSet
+	file               string
+	threadiness        int
+	baseDelay          time.Duration
+	maxDelay           time.Duration
+	drainTimeout       time.Duration
+	recentWritesWindow time.Duration
+	consistentReadWait time.Duration
+}
+
+// AddTuningFlags adds flags for a tuning file and for the tuning that isn't per GVK to the flag set. Call Tuning
+// after the flags are parsed.
+func AddTuningFlags(fs *flag.FlagSet) *TuningFlags {
+	f := &TuningFlags{fs: fs}
+	fs.StringVar(&f.file, "nah-tuning-file", "", "YAML or JSON file with the controller tuning")
+	fs.IntVar(&f.threadiness, "nah-threadiness", 0, "Number of workers of each GVK")
+	fs.DurationVar(&f.baseDelay, "nah-rate-limit-base-delay", 0, "First delay of the backoff of keys that fail")
+	fs.DurationVar(&f.maxDelay, "nah-rate-limit-max-delay", 0, "Maximum delay of the backoff of keys that fail")
+	fs.DurationVar(&f.drainTimeout, "nah-drain-timeout", 0, "How long to wait for the keys being handled on shutdown")
+	fs.DurationVar(&f.recentWritesWindow, "nah-recent-writes-window", 0, "How long writes are merged into cached reads")
+	fs.DurationVar(&f.consistentReadWait, "nah-consistent-read-wait", 0, "How long reads wait for the cache to see a resourceVersion")
+	return f
+}
+
+// Tuning returns the tuning of the file, if it is set, overridden by the other flags that are set.
+func (f *TuningFlags) Tuning() (*Tuning, error) {
+	t := &Tuning{}
+	if f.file != "" {
+		var err error
+		if t, err = LoadTuning(f.file); err != nil {
+			return nil, err
+		}
+	}
+
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "nah-threadiness":
+			t.Threadiness = f.threadiness
+		case "nah-rate-limit-base-delay", "nah-rate-limit-max-delay":
+			if t.RateLimit == nil {
+				// The delay that isn't set keeps its default
+				t.RateLimit = &RateLimit{
+					BaseDelay: metav1.Duration{Duration: nruntime.DefaultRateLimitBaseDelay},
+					MaxDelay:  metav1.Duration{Duration: nruntime.DefaultRateLimitMaxDelay},
+				}
+			}
+			if fl.Name == "nah-rate-limit-base-delay" {
+				t.RateLimit.BaseDelay.Duration = f.baseDelay
+			} else {
+				t.RateLimit.MaxDelay.Duration = f.maxDelay
+			}
+		case "nah-drain-timeout":
+			t.DrainTimeout = &metav1.Duration{Duration: f.drainTimeout}
+		case "nah-recent-writes-window":
+			t.RecentWritesWindow = &metav1.Duration{Duration: f.recentWritesWindow}
+		case "nah-consistent-read-wait":
+			t.ConsistentReadWait = &metav1.Duration{Duration: f.consistentReadWait}
+		}
+	})
+
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid tuning: %w", err)
+	}
+	return t, nil
+}
+
+// Validate returns all the problems with the tuning.
+func (t *Tuning) Validate() error {
+	if t == nil {
+		return nil
+	}
+
+	var errs []error
+	if t.Threadiness < 0 {
+		errs = append(errs, fmt.Errorf("threadiness must not be negative"))
+	}
+	if err := t.RateLimit.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	seen := map[schema.GroupVersionKind]bool{}
+	for i, g := range t.GVKs {
+		gvk, err := g.gvk()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("gvks[%d]: %w", i, err))
+			continue
+		}
+		if seen[gvk] {
+			errs = append(errs, fmt.Errorf("gvks[%d]: %v is tuned more than once", i, gvk))
+		}
+		seen[gvk] = true
+
+		if g.Threadiness < 0 {
+			errs = append(errs, fmt.Errorf("gvks[%d]: threadiness must not be negative", i))
+		}
+		if g.Queues < 0 {
+			errs = append(errs, fmt.Errorf("gvks[%d]: queues must not be negative", i))
+		}
+		if err := g.RateLimit.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("gvks[%d]: %w", i, err))
+		}
+		if g.FairQueue != nil {
+			for ns, weight := range g.FairQueue.Weights {
+				if weight <= 0 {
+					errs = append(errs, fmt.Errorf("gvks[%d]: fair queue weight of %q must be positive", i, ns))
+				}
+			}
+		}
+		if err := validateLanes(g.PriorityLanes); err != nil {
+			errs = append(errs, fmt.Errorf("gvks[%d]: %w", i, err))
+		}
+		if g.DeadLetter != nil && g.DeadLetter.MaxAttempts < 0 {
+			errs = append(errs, fmt.Errorf("gvks[%d]: dead letter max attempts must not be negative", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RateLimit) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.BaseDelay.Duration <= 0 {
+		return fmt.Errorf("rate limit base delay must be positive")
+	}
+	if r.MaxDelay.Duration < r.BaseDelay.Duration {
+		return fmt.Errorf("rate limit max delay %s is less than the base delay %s", r.MaxDelay.Duration, r.BaseDelay.Duration)
+	}
+	return nil
+}
+
+func (r *RateLimit) rateLimiter() workqueue.TypedRateLimiter[any] {
+	return workqueue.NewTypedItemExponentialFailureRateLimiter[any](r.BaseDelay.Duration, r.MaxDelay.Duration)
+}
+
+func validateLanes(lanes *nruntime.PriorityLanes) error {
+	if lanes != nil && (lanes.Changes < 0 || lanes.Triggers < 0 || lanes.Retries < 0) {
+		return fmt.Errorf("priority lane weights must not be negative")
+	}
+	return nil
+}
+
+func (g GVKTuning) gvk() (schema.GroupVersionKind, error) {
+	if g.APIVersion == "" || g.Kind == "" {
+		return schema.GroupVersionKind{}, fmt.Errorf("apiVersion and kind are required")
+	}
+	gv, err := schema.ParseGroupVersion(g.APIVersion)
+	if err != nil {
+		return schema.GroupVersionKind{}, err
+	}
+	return gv.WithKind(g.Kind), nil
+}
+
+// apply sets the fields of the options that the tuning sets. The maps of the options are copied before they
+// are changed.
+func (t *Tuning) apply(o *Options) {
+	if t.Threadiness > 0 {
+		o.DefaultThreadiness = t.Threadiness
+	}
+	if t.RateLimit != nil {
+		o.DefaultRateLimiter = t.RateLimit.rateLimiter()
+	}
+	if t.DrainTimeout != nil {
+		o.DrainTimeout = t.DrainTimeout.Duration
+	}
+	if t.RecentWritesWindow != nil {
+		o.RecentWritesWindow = t.RecentWritesWindow.Duration
+	}
+	if t.ConsistentReadWait != nil {
+		o.ConsistentReadWait = t.ConsistentReadWait.Duration
+	}
+	if len(t.GVKs) == 0 {
+		return
+	}
+
+	o.GVKThreadiness = cloneOrNew(o.GVKThreadiness)
+	o.GVKRateLimiters = cloneOrNew(o.GVKRateLimiters)
+	o.GVKQueueSplitters = cloneOrNew(o.GVKQueueSplitters)
+	o.GVKFairQueues = cloneOrNew(o.GVKFairQueues)
+	o.GVKPriorityLanes = cloneOrNew(o.GVKPriorityLanes)
+	o.GVKDeadLetters = cloneOrNew(o.GVKDeadLetters)
+	o.GVKPaused = cloneOrNew(o.GVKPaused)
+
+	for _, g := range t.GVKs {
+		gvk, err := g.gvk()
+		if err != nil {
+			// Validate reports this
+			continue
+		}
+		if g.Threadiness > 0 {
+			o.GVKThreadiness[gvk] = g.Threadiness
+		}
+		if g.RateLimit != nil {
+			o.GVKRateLimiters[gvk] = g.RateLimit.rateLimiter()
+		}
+		if g.Queues > 0 {
+			o.GVKQueueSplitters[gvk] = nruntime.NewHashQueueSplitter(g.Queues)
+		}
+		if g.FairQueue != nil {
+			weights := g.FairQueue.Weights
+			o.GVKFairQueues[gvk] = &nruntime.FairQueue{
+				Weight: func(tenant string) int {
+					return weights[tenant]
+				},
+			}
+		}
+		if g.PriorityLanes != nil {
+			o.GVKPriorityLanes[gvk] = g.PriorityLanes
+		}
+		if g.DeadLetter != nil {
+			o.GVKDeadLetters[gvk] = g.DeadLetter
+		}
+		if g.Paused {
+			o.GVKPaused[gvk] = true
+		}
+	}
+}
+
+func cloneOrNew[V any](m map[schema.GroupVersionKind]V) map[schema.GroupVersionKind]V {
+	if m == nil {
+		return map[schema.GroupVersionKind]V{}
+	}
+	return maps.Clone(m)
+}
+
+// validate returns all the problems with the controller tuning of the options.
+func (o *Options) validate() error {
+	var errs []error
+	if o.DefaultThreadiness < 0 {
+		errs = append(errs, fmt.Errorf("default threadiness must not be negative"))
+	}
+	for gvk, threadiness := range o.GVKThreadiness {
+		if threadiness <= 0 {
+			errs = append(errs, fmt.Errorf("threadiness of %v must be positive", gvk))
+		}
+	}
+	for gvk, splitter := range o.GVKQueueSplitters {
+		if splitter == nil || splitter.Queues() <= 0 {
+			errs = append(errs, fmt.Errorf("queue splitter of %v must have at least one queue", gvk))
+		}
+	}
+	for gvk, lanes := range o.GVKPriorityLanes {
+		if err := validateLanes(lanes); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", gvk, err))
+		}
+	}
+	for gvk, deadLetter := range o.GVKDeadLetters {
+		if deadLetter != nil && deadLetter.MaxAttempts < 0 {
+			errs = append(errs, fmt.Errorf("dead letter max attempts of %v must not be negative", gvk))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// logTuning logs the effective controller tuning of the options. If a Backend was provided, only the tuning of the
+// router is logged, the rest is ignored.
+func (o *Options) logTuning(backendProvided bool) {
+	drainTimeout := o.DrainTimeout
+	if drainTimeout == 0 {
+		drainTimeout = router.DefaultDrainTimeout
+	}
+	if backendProvided {
+		log.Infof("Controller tuning: drainTimeout=%s, the rest is set by the provided backend", drainTimeout)
+		return
+	}
+
+	threadiness := o.DefaultThreadiness
+	if threadiness == 0 {
+		threadiness = nruntime.DefaultThreadiness
+	}
+	recentWritesWindow := o.RecentWritesWindow
+	if recentWritesWindow == 0 {
+		recentWritesWindow = nruntime.DefaultRecentWindow
+	}
+	consistentReadWait := o.ConsistentReadWait
+	if consistentReadWait == 0 {
+		consistentReadWait = nruntime.DefaultConsistentReadWait
+	}
+	rateLimiter := "default"
+	if o.DefaultRateLimiter != nil {
+		rateLimiter = "custom"
+	}
+	log.Infof("Controller tuning: threadiness=%d rateLimiter=%s drainTimeout=%s recentWritesWindow=%s consistentReadWait=%s",
+		threadiness, rateLimiter, drainTimeout, recentWritesWindow, consistentReadWait)
+
+	gvks := map[schema.GroupVersionKind][]string{}
+	for gvk, v := range o.GVKThreadiness {
+		gvks[gvk] = append(gvks[gvk], fmt.Sprintf("threadiness=%d", v))
+	}
+	for gvk := range o.GVKRateLimiters {
+		gvks[gvk] = append(gvks[gvk], "rateLimiter=custom")
+	}
+	for gvk, v := range o.GVKQueueSplitters {
+		gvks[gvk] = append(gvks[gvk], fmt.Sprintf("queues=%d", v.Queues()))
+	}
+	for gvk := range o.GVKFairQueues {
+		gvks[gvk] = append(gvks[gvk], "fairQueue=true")
+	}
+	for gvk, v := range o.GVKPriorityLanes {
+		if v == nil {
+			continue
+		}
+		gvks[gvk] = append(gvks[gvk], fmt.Sprintf("priorityLanes=%d/%d/%d", v.Changes, v.Triggers, v.Retries))
+	}
+	for gvk, v := range o.GVKDeadLetters {
+		if v == nil {
+			continue
+		}
+		gvks[gvk] = append(gvks[gvk], fmt.Sprintf("maxAttempts=%d", v.MaxAttempts))
+	}
+	for gvk, v := range o.GVKPaused {
+		if v {
+			gvks[gvk] = append(gvks[gvk], "paused=true")
+		}
+	}
+	for gvk, v := range o.GVKMetadataOnly {
+		if v {
+			gvks[gvk] = append(gvks[gvk], "metadataOnly=true")
+		}
+	}
+
+	for _, gvk := range slices.SortedFunc(maps.Keys(gvks), func(a, b schema.GroupVersionKind) int {
+		return strings.Compare(a.String(), b.String())
+	}) {
+		parts := gvks[gvk]
+		slices.Sort(parts)
+		log.Infof("Controller tuning of [%v]: %s", gvk, strings.Join(parts, " "))
+	}
+}